@@ -41,8 +41,9 @@ func RunKtrlTCP() {
 		},
 		RunFunc: func(ctx *ktrl.KtrlContext) {
 			args := ctx.GetArgs()
-			fmt.Println("args info in RunFunc: ", args)
-			fmt.Println("Result from server: ", string(ctx.Result))
+			fmt.Fprintln(ctx.Writer(), "args info in RunFunc: ", args)
+			fmt.Fprint(ctx.Writer(), "Result from server: ")
+			ctx.PrintResult()
 		},
 		Handler: func(ctx *ktrl.KtrlContext) {
 			args := ctx.GetArgs()
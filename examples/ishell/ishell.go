@@ -11,6 +11,8 @@ import (
 
 func main() {
 	ishell := shell.NewIShell()
+	// recover from panics in any command.
+	ishell.Use(shell.Recover())
 
 	h := shell.NewShellCmd()
 	h.Name = "hello"
@@ -25,10 +27,10 @@ func main() {
 		},
 	}
 	h.Run = func(cmd *cobra.Command, args []string) {
-		fmt.Println("hello, how are you?")
+		fmt.Fprintln(cmd.OutOrStdout(), "hello, how are you?")
 		enable, _ := cmd.Flags().GetBool("enable")
 		if enable {
-			fmt.Println("Extra info is enabled.")
+			fmt.Fprintln(cmd.OutOrStdout(), "Extra info is enabled.")
 		}
 	}
 	ishell.AddCmd(h)
@@ -43,15 +45,40 @@ func main() {
 	sub.Name = "show"
 	sub.HelpStr = "Show test info."
 	sub.Run = func(cmd *cobra.Command, args []string) {
-		fmt.Println("show test.")
-		fmt.Println(args)
+		fmt.Fprintln(cmd.OutOrStdout(), "show test.")
+		fmt.Fprintln(cmd.OutOrStdout(), args)
 	}
 	ishell.AddChild(tParent, sub)
 
+	type greetOptions struct {
+		Times int    `flag:"times" short:"t" default:"1" min:"1" max:"10" usage:"times to greet."`
+		Name  string `arg:"name" usage:"who to greet."`
+	}
+	greet, _ := shell.NewStructCmd("greet", func(cmd *cobra.Command, opts *greetOptions) error {
+		for i := 0; i < opts.Times; i++ {
+			fmt.Fprintf(cmd.OutOrStdout(), "hello, %s!\n", opts.Name)
+		}
+		return nil
+	})
+	greet.HelpStr = "An example of struct-tag driven command."
+	ishell.AddCmd(greet)
+
+	// enter with "menu config", leave with "back".
+	config, _ := ishell.NewMenu("config")
+	config.HelpStr = "An example of menu."
+	get := shell.NewShellCmd()
+	get.Name = "get"
+	get.HelpStr = "Show config info."
+	get.Run = func(cmd *cobra.Command, args []string) {
+		fmt.Fprintln(cmd.OutOrStdout(), "config get.")
+	}
+	config.AddCmd(get)
+
 	ishell.SetHistoryFilePath(".gshell_history", 300, true)
 	// print logo when shell started.
 	ishell.SetPrintLogo(func(_ *console.Console) {
 		gprint.Yellow("Welcome to gshell!")
 	})
-	ishell.Start()
+	// run "ishell show -e" from bash, or the interactive shell without args.
+	ishell.Main()
 }
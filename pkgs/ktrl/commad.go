@@ -1,10 +1,15 @@
 package ktrl
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogf/gf/v2/util/gconv"
@@ -34,13 +39,14 @@ type Option struct {
 }
 
 type KtrlContext struct {
-	GinCtx  *gin.Context
-	Command *cobra.Command
-	Route   string
-	args    []string
-	Options []*shell.Flag
-	Result  []byte
-	Type    int8
+	GinCtx     *gin.Context
+	Command    *cobra.Command
+	Route      string
+	args       []string
+	Options    []*shell.Flag
+	Result     []byte
+	StatusCode int // status code of the response from server
+	Type       int8
 }
 
 // Send reponse back to client.
@@ -67,6 +73,59 @@ func (kctx *KtrlContext) SendResponse(content interface{}, code ...int) {
 	}
 }
 
+/*
+Context returns the context of the invocation.
+On client side it is cancelled on Ctrl-C, which aborts the request to server,
+on server side it is cancelled when the client aborts the request.
+*/
+func (kctx *KtrlContext) Context() context.Context {
+	if kctx.GinCtx != nil {
+		return kctx.GinCtx.Request.Context()
+	}
+	if kctx.Command != nil && kctx.Command.Context() != nil {
+		return kctx.Command.Context()
+	}
+	return context.Background()
+}
+
+/*
+Writer returns the writer for output on client side,
+which is piped or redirected by the shell, eg: "show | grep foo", "show > out.txt".
+*/
+func (kctx *KtrlContext) Writer() io.Writer {
+	if kctx.Command != nil {
+		return kctx.Command.OutOrStdout()
+	}
+	return os.Stdout
+}
+
+// DecodeResult decodes the JSON result from server into v, numbers are decoded as json.Number.
+func (kctx *KtrlContext) DecodeResult(v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(kctx.Result))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// ErrWriter returns the writer for errors on client side, which is redirected by the shell.
+func (kctx *KtrlContext) ErrWriter() io.Writer {
+	if kctx.Command != nil {
+		return kctx.Command.ErrOrStderr()
+	}
+	return os.Stderr
+}
+
+// PrintResult writes the result from server to Writer.
+func (kctx *KtrlContext) PrintResult() error {
+	if _, err := kctx.Writer().Write(kctx.Result); err != nil {
+		return err
+	}
+	if len(kctx.Result) > 0 && kctx.Result[len(kctx.Result)-1] != '\n' {
+		_, err := io.WriteString(kctx.Writer(), "\n")
+		return err
+	}
+	return nil
+}
+
 func (kctx *KtrlContext) SetArgs(args ...string) {
 	kctx.args = args
 }
@@ -74,17 +133,40 @@ func (kctx *KtrlContext) SetArgs(args ...string) {
 // parse flags and args for server.
 func (kctx *KtrlContext) GetArgs() []string {
 	if kctx.Type == ContextTypeServer && kctx.GinCtx != nil {
-		args := kctx.GinCtx.Query(QueryArgsName)
-		kctx.args = strings.Split(args, ",")
+		kctx.args = kctx.GinCtx.QueryArray(QueryArgsName)
 	}
 	return kctx.args
 }
 
+func (kctx *KtrlContext) getDefault(name string) string {
+	for _, opt := range kctx.Options {
+		if opt.GetName() == name {
+			return opt.GetDefault()
+		}
+	}
+	return ""
+}
+
+// query returns the flag value sent by client, or the default value if the flag is not set.
+func (kctx *KtrlContext) query(name string) string {
+	if v, ok := kctx.GinCtx.GetQuery(name); ok {
+		return v
+	}
+	return kctx.getDefault(name)
+}
+
+func (kctx *KtrlContext) queryArray(name string) []string {
+	if v, ok := kctx.GinCtx.GetQueryArray(name); ok {
+		return v
+	}
+	return shell.SplitDefault(kctx.getDefault(name))
+}
+
 func (kctx *KtrlContext) GetString(name string) (r string) {
 	if kctx.Type == ContextTypeClient {
 		r, _ = kctx.Command.Flags().GetString(name)
 	} else {
-		r = kctx.GinCtx.Query(name)
+		r = kctx.query(name)
 	}
 	return
 }
@@ -93,7 +175,7 @@ func (kctx *KtrlContext) GetBool(name string) (r bool) {
 	if kctx.Type == ContextTypeClient {
 		r, _ = kctx.Command.Flags().GetBool(name)
 	} else {
-		str := kctx.GinCtx.Query(name)
+		str := kctx.query(name)
 		r = gconv.Bool(str)
 	}
 	return
@@ -103,7 +185,7 @@ func (kctx *KtrlContext) GetInt(name string) (r int) {
 	if kctx.Type == ContextTypeClient {
 		r, _ = kctx.Command.Flags().GetInt(name)
 	} else {
-		str := kctx.GinCtx.Query(name)
+		str := kctx.query(name)
 		r = gconv.Int(str)
 	}
 	return
@@ -113,21 +195,171 @@ func (kctx *KtrlContext) GetFloat(name string) (r float64) {
 	if kctx.Type == ContextTypeClient {
 		r, _ = kctx.Command.Flags().GetFloat64(name)
 	} else {
-		str := kctx.GinCtx.Query(name)
+		str := kctx.query(name)
 		r = gconv.Float64(str)
 	}
 	return
 }
 
+func (kctx *KtrlContext) GetUint(name string) (r uint) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetUint(name)
+	} else {
+		str := kctx.query(name)
+		r = gconv.Uint(str)
+	}
+	return
+}
+
+func (kctx *KtrlContext) GetInt64(name string) (r int64) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetInt64(name)
+	} else {
+		str := kctx.query(name)
+		r = gconv.Int64(str)
+	}
+	return
+}
+
+func (kctx *KtrlContext) GetDuration(name string) (r time.Duration) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetDuration(name)
+	} else {
+		str := kctx.query(name)
+		r = gconv.Duration(str)
+	}
+	return
+}
+
+// GetCount returns the value of a counter flag, eg: 3 for -vvv.
+func (kctx *KtrlContext) GetCount(name string) (r int) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetCount(name)
+	} else {
+		str := kctx.query(name)
+		r = gconv.Int(str)
+	}
+	return
+}
+
+func (kctx *KtrlContext) GetStringSlice(name string) (r []string) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetStringSlice(name)
+	} else {
+		r = kctx.queryArray(name)
+	}
+	return
+}
+
+func (kctx *KtrlContext) GetIntSlice(name string) (r []int) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetIntSlice(name)
+	} else {
+		strs := kctx.queryArray(name)
+		r = gconv.Ints(strs)
+	}
+	return
+}
+
+func (kctx *KtrlContext) GetStringMap(name string) (r map[string]string) {
+	if kctx.Type == ContextTypeClient {
+		r, _ = kctx.Command.Flags().GetStringToString(name)
+	} else {
+		strs := kctx.queryArray(name)
+		r = shell.ParseStringMap(strs)
+	}
+	return
+}
+
+// Bind populates the tagged fields of a struct pointer from flags and args, see shell.BindStruct.
+func (kctx *KtrlContext) Bind(v any) error {
+	if kctx.Type == ContextTypeClient {
+		return shell.BindStruct(v, shell.NewCobraFlagSource(kctx.Command.Flags()), kctx.GetArgs())
+	}
+	return shell.BindStruct(v, &queryFlagSource{kctx.GinCtx}, kctx.GetArgs())
+}
+
+// queryFlagSource provides flags sent by client for validation on server side.
+type queryFlagSource struct {
+	gctx *gin.Context
+}
+
+func (q *queryFlagSource) Changed(name string) bool {
+	_, ok := q.gctx.GetQuery(name)
+	return ok
+}
+
+func (q *queryFlagSource) Values(name string) []string {
+	return q.gctx.QueryArray(name)
+}
+
 type KtrlCommand struct {
-	Name          string                 // cmd name
-	Parent        string                 // parent cmd name
-	HelpStr       string                 // Short for cobra cmd
-	LongHelpStr   string                 // Long for cobra cmd
-	Options       []*shell.Flag          // flags for cobra
-	SendInRunFunc bool                   // Send request in RunFunc
-	RunFunc       func(ctx *KtrlContext) // Not Nil. Hook for cobra.
-	Handler       func(ctx *KtrlContext) // Not Nil. Handler for server.
+	Name              string                              // cmd name
+	Aliases           []string                            // other names of the cmd, routes are registered for them on server side
+	DeprecatedAliases []string                            // old names of the cmd, still working with a deprecation warning
+	Hidden            bool                                // hide the cmd from help and completion
+	Deprecated        string                              // deprecation notice, eg: `use "net route" instead`
+	Group             *shell.CmdGroup                     // group in help output of the parent cmd
+	Parent            string                              // parent cmd path, eg: "net.route"
+	HelpStr           string                              // Short for cobra cmd
+	LongHelpStr       string                              // Long for cobra cmd
+	Options           []*shell.Flag                       // flags for cobra
+	PersistentOptions []*shell.Flag                       // flags inherited by all descendants
+	Args              []*shell.Arg                        // positional args, nil for any args
+	Completer         *shell.Completer                    // completion for any positional args when Args is nil
+	MutuallyExclusive [][]string                          // groups of flags that cannot be used together
+	RequiredTogether  [][]string                          // groups of flags that must be used together
+	SendInRunFunc     bool                                // Send request in RunFunc
+	PreRunE           func(ctx *KtrlContext) error        // Called on client side before the request is sent, the cmd fails with the error.
+	RunFunc           func(ctx *KtrlContext)              // Hook for cobra. Nil for a cmd only grouping children.
+	RunFuncE          func(ctx *KtrlContext) error        // Used instead of RunFunc if not nil.
+	Handler           func(ctx *KtrlContext)              // Handler for server. Nil for a cmd only grouping children.
+	HandlerE          func(ctx *KtrlContext) error        // Used instead of Handler if not nil, the error is sent back to client.
+	RunData           func(ctx *KtrlContext) (any, error) // Used instead of RunFuncE if not nil, the data is rendered as selected by --output.
+	HandlerData       func(ctx *KtrlContext) (any, error) // Used instead of HandlerE if not nil, the data is sent back to client as JSON, and rendered by default.
+	Columns           []string                            // default columns of table output.
+	NoPager           bool                                // never show the output in the pager.
+}
+
+/*
+NewStructCommand creates a cmd whose flags and positional args are declared by the tagged fields of T,
+see shell.BindStruct. A new T is populated before each invocation of runFunc and handler.
+On client side T is populated before the request is sent, the cmd fails with the error if T cannot be populated.
+On server side the error is sent back to client with http.StatusBadRequest.
+The result from server is printed if runFunc is nil.
+*/
+func NewStructCommand[T any](name string, runFunc, handler func(ctx *KtrlContext, opts *T) error) (kc *KtrlCommand, err error) {
+	kc = &KtrlCommand{Name: name}
+	kc.Options, kc.Args, err = shell.ParseStruct(new(T))
+	if err != nil {
+		return nil, err
+	}
+	kc.PreRunE = func(ctx *KtrlContext) error {
+		return ctx.Bind(new(T))
+	}
+	wrap := func(f func(ctx *KtrlContext, opts *T) error) func(ctx *KtrlContext) error {
+		if f == nil {
+			return nil
+		}
+		return func(ctx *KtrlContext) error {
+			opts := new(T)
+			if err := ctx.Bind(opts); err != nil {
+				if ctx.Type == ContextTypeServer {
+					ctx.SendResponse(err.Error(), http.StatusBadRequest)
+				}
+				return err
+			}
+			return f(ctx, opts)
+		}
+	}
+	if runFunc == nil {
+		runFunc = func(ctx *KtrlContext, _ *T) error {
+			return ctx.PrintResult()
+		}
+	}
+	kc.RunFuncE = wrap(runFunc)
+	kc.HandlerE = wrap(handler)
+	return
 }
 
 // Route for current cmd.
@@ -135,10 +367,32 @@ func (kc *KtrlCommand) GetRoute() string {
 	return FormatRoute(kc.Name, kc.Parent)
 }
 
+// Routes for the aliases of current cmd.
+func (kc *KtrlCommand) GetAliasRoutes() (routes []string) {
+	for _, alias := range append(append([]string{}, kc.Aliases...), kc.DeprecatedAliases...) {
+		routes = append(routes, FormatRoute(alias, kc.Parent))
+	}
+	return
+}
+
+// Path for current cmd, eg: "net.route.add".
+func (kc *KtrlCommand) GetPath() string {
+	return shell.GetFlagKey(kc.Parent, kc.Name)
+}
+
+// Depth of current cmd in the cmd tree, top level cmds have a depth of 0.
+func (kc *KtrlCommand) GetDepth() int {
+	if kc.Parent == "" {
+		return 0
+	}
+	return strings.Count(kc.Parent, shell.CmdPathSep) + 1
+}
+
+// FormatRoute converts a cmd path to a route, eg: "net.route" + "add" -> "/net/route/add/".
 func FormatRoute(name, parent string) string {
 	if parent == "" {
 		return fmt.Sprintf("/%s/", name)
 	} else {
-		return fmt.Sprintf("/%s/%s/", parent, name)
+		return fmt.Sprintf("/%s/%s/", strings.ReplaceAll(parent, shell.CmdPathSep, "/"), name)
 	}
 }
@@ -2,17 +2,23 @@ package ktrl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
 	"github.com/gvcgo/goutils/pkgs/gutils"
 	"github.com/gvcgo/gshell/pkgs/shell"
 	"github.com/reeflective/console"
@@ -24,15 +30,30 @@ const (
 	PingResponse string = "pong"
 )
 
+// ShutdownTimeout is the time StopServer waits for running handlers.
+var ShutdownTimeout = 5 * time.Second
+
+var ErrNoServer = errors.New("no ktrl server configured")
+
 type Ktrl struct {
 	iShell   *shell.IShell
 	client   *http.Client
 	engine   *gin.Engine
+	server   *http.Server
 	conf     *KtrlConf
 	commands []*KtrlCommand
 	l        *sync.Mutex
+
+	middlewares      []Middleware
+	shellMiddlewares []shell.Middleware
 }
 
+// HandlerFunc is the invocation of a server handler, Handler of KtrlCommand is converted to a HandlerFunc returning nil.
+type HandlerFunc func(ctx *KtrlContext) error
+
+// Middleware wraps the invocation of server handlers, eg: for timing, logging, authorization or panic recovery.
+type Middleware func(next HandlerFunc) HandlerFunc
+
 func NewKtrl(cfg *KtrlConf) (k *Ktrl) {
 	k = &Ktrl{
 		conf: cfg,
@@ -51,16 +72,91 @@ func (k *Ktrl) AddCommand(kcmd *KtrlCommand) {
 	k.l.Unlock()
 }
 
+// Use appends middlewares wrapping every server handler, the first one is the outermost.
+func (k *Ktrl) Use(middlewares ...Middleware) {
+	k.l.Lock()
+	k.middlewares = append(k.middlewares, middlewares...)
+	k.l.Unlock()
+}
+
+// UseShell appends middlewares wrapping every cmd of the shell, see shell.IShell.Use.
+func (k *Ktrl) UseShell(middlewares ...shell.Middleware) {
+	k.l.Lock()
+	k.shellMiddlewares = append(k.shellMiddlewares, middlewares...)
+	k.l.Unlock()
+	if k.iShell != nil {
+		k.iShell.Use(middlewares...)
+	}
+}
+
+// chain wraps the server handler of a cmd with the middlewares.
+func (k *Ktrl) chain(kc *KtrlCommand) HandlerFunc {
+	handle := HandlerFunc(kc.HandlerE)
+	if kc.HandlerData != nil {
+		handle = func(ctx *KtrlContext) error {
+			data, err := kc.HandlerData(ctx)
+			if err != nil {
+				return err
+			}
+			ctx.GinCtx.JSON(http.StatusOK, data)
+			return nil
+		}
+	}
+	if handle == nil {
+		handle = func(ctx *KtrlContext) error {
+			kc.Handler(ctx)
+			return nil
+		}
+	}
+	k.l.Lock()
+	middlewares := slices.Clone(k.middlewares)
+	k.l.Unlock()
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handle = middlewares[i](handle)
+	}
+	return handle
+}
+
+// Recover is a middleware converting a panic in a server handler to an error sent back to client.
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *KtrlContext) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic in %q: %v", ctx.Route, r)
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
+
+// getOptions returns the flags of a cmd, including the persistent flags of the cmd and its ancestors.
+func (k *Ktrl) getOptions(kc *KtrlCommand) []*shell.Flag {
+	opts := append(append([]*shell.Flag{}, kc.Options...), kc.PersistentOptions...)
+	for parent := kc.Parent; parent != ""; {
+		var found *KtrlCommand
+		for _, c := range k.commands {
+			if c.GetPath() == parent {
+				found = c
+				break
+			}
+		}
+		if found == nil {
+			break
+		}
+		opts = append(opts, found.PersistentOptions...)
+		parent = found.Parent
+	}
+	return opts
+}
+
 /*
 client
 */
-func (k *Ktrl) parseParams(params map[string]string) (p string) {
-	for k, v := range params {
-		if len(p) == 0 {
-			p += fmt.Sprintf("?%s=%s", k, v)
-		} else {
-			p += fmt.Sprintf("&%s=%s", k, v)
-		}
+func (k *Ktrl) parseParams(params url.Values) (p string) {
+	if len(params) > 0 {
+		p = "?" + params.Encode()
 	}
 	return
 }
@@ -84,37 +180,78 @@ func (k *Ktrl) getClient() {
 	}
 }
 
+// GetResult sends request to server, the response is stored in ctx.Result, see GetResultE.
 func (k *Ktrl) GetResult(ctx *KtrlContext) {
+	k.GetResultE(ctx)
+}
+
+// GetResultE sends request to server like GetResult, an error is returned if the request or the server fails.
+func (k *Ktrl) GetResultE(ctx *KtrlContext) error {
 	k.getClient()
 	if k.client == nil {
-		return
+		return ErrNoServer
 	}
-	params := map[string]string{}
+	params := url.Values{}
 	if ctx.Command != nil {
+		flags := ctx.Command.Flags()
 		for _, opt := range ctx.Options {
+			name := opt.GetName()
+			// unset flags fall back to their defaults on server side.
+			if !flags.Changed(name) {
+				continue
+			}
 			switch opt.GetType() {
 			case shell.OptionTypeBool:
-				v, _ := ctx.Command.Flags().GetBool(opt.GetName())
-				params[opt.GetName()] = gconv.String(v)
+				v, _ := flags.GetBool(name)
+				params.Set(name, gconv.String(v))
 			case shell.OptionTypeInt:
-				v, _ := ctx.Command.Flags().GetInt(opt.GetName())
-				params[opt.GetName()] = gconv.String(v)
+				v, _ := flags.GetInt(name)
+				params.Set(name, gconv.String(v))
 			case shell.OptionTypeFloat:
-				v, _ := ctx.Command.Flags().GetFloat64(opt.GetName())
-				params[opt.GetName()] = gconv.String(v)
+				v, _ := flags.GetFloat64(name)
+				params.Set(name, gconv.String(v))
+			case shell.OptionTypeUint:
+				v, _ := flags.GetUint(name)
+				params.Set(name, gconv.String(v))
+			case shell.OptionTypeInt64:
+				v, _ := flags.GetInt64(name)
+				params.Set(name, gconv.String(v))
+			case shell.OptionTypeDuration:
+				v, _ := flags.GetDuration(name)
+				params.Set(name, v.String())
+			case shell.OptionTypeCount:
+				v, _ := flags.GetCount(name)
+				params.Set(name, gconv.String(v))
+			case shell.OptionTypeStringSlice:
+				v, _ := flags.GetStringSlice(name)
+				params[name] = v
+			case shell.OptionTypeIntSlice:
+				v, _ := flags.GetIntSlice(name)
+				params[name] = gconv.Strings(v)
+			case shell.OptionTypeStringMap:
+				v, _ := flags.GetStringToString(name)
+				params[name] = shell.FormatStringMap(v)
 			default:
-				v, _ := ctx.Command.Flags().GetString(opt.GetName())
-				params[opt.GetName()] = v
+				v, _ := flags.GetString(name)
+				params.Set(name, v)
 			}
 		}
 	} else {
+		// flags without defaults are unset, the flags sent are set by user on server side.
 		for _, opt := range ctx.Options {
-			params[opt.GetName()] = opt.GetDefault()
+			if opt.GetDefault() == "" {
+				continue
+			}
+			if opt.GetType().IsMulti() {
+				params[opt.GetName()] = shell.SplitDefault(opt.GetDefault())
+			} else {
+				params.Set(opt.GetName(), opt.GetDefault())
+			}
 		}
 	}
 
 	if len(ctx.args) > 0 {
-		params[QueryArgsName] = strings.Join(ctx.args, ",")
+		params[QueryArgsName] = ctx.args
 	}
 
 	var kUrl string
@@ -123,49 +260,120 @@ func (k *Ktrl) GetResult(ctx *KtrlContext) {
 	} else {
 		kUrl = fmt.Sprintf("http://%s:%d%s%s", k.conf.ServerHost, k.conf.ServerPort, ctx.Route, k.parseParams(params))
 	}
-	resp, err := k.client.Get(kUrl)
+	req, err := http.NewRequestWithContext(ctx.Context(), http.MethodGet, kUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
 	if err != nil {
-		return
+		return err
 	}
 	defer resp.Body.Close()
-	ctx.Result, _ = io.ReadAll(resp.Body)
+	ctx.StatusCode = resp.StatusCode
+	ctx.Result, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.New(strings.TrimSpace(string(ctx.Result)))
+	}
+	return nil
 }
 
 func (k *Ktrl) addShellCmd() {
-	for _, c := range k.commands {
+	// parents must be added before their children.
+	commands := make([]*KtrlCommand, len(k.commands))
+	copy(commands, k.commands)
+	sort.SliceStable(commands, func(i, j int) bool {
+		return commands[i].GetDepth() < commands[j].GetDepth()
+	})
+
+	for _, c := range commands {
 		command := c // replicate, in case "c" will be covered.
-		if command.RunFunc == nil {
-			continue
-		}
+		options := k.getOptions(command)
 
 		shellCmd := shell.NewShellCmd()
 		shellCmd.Name = command.Name
+		shellCmd.Aliases = command.Aliases
+		shellCmd.DeprecatedAliases = command.DeprecatedAliases
+		shellCmd.Hidden = command.Hidden
+		shellCmd.Deprecated = command.Deprecated
+		shellCmd.Group = command.Group
 		shellCmd.HelpStr = command.HelpStr
 		shellCmd.LongHelpStr = command.LongHelpStr
 		shellCmd.Options = command.Options
-		shellCmd.Run = func(cmd *cobra.Command, args []string) {
+		shellCmd.PersistentOptions = command.PersistentOptions
+		shellCmd.Args = command.Args
+		shellCmd.Completer = command.Completer
+		shellCmd.MutuallyExclusive = command.MutuallyExclusive
+		shellCmd.RequiredTogether = command.RequiredTogether
+		shellCmd.Columns = command.Columns
+		shellCmd.NoPager = command.NoPager
+		// newContext returns the context of an invocation, with the result from server unless SendInRunFunc.
+		newContext := func(cmd *cobra.Command, args []string) (*KtrlContext, error) {
 			ctx := &KtrlContext{
 				Command: cmd,
 				args:    args,
-				Options: c.Options,
+				Options: options,
 				Route:   command.GetRoute(),
 				Type:    ContextTypeClient,
 			}
+			if command.PreRunE != nil {
+				if err := command.PreRunE(ctx); err != nil {
+					return nil, err
+				}
+			}
 			if !command.SendInRunFunc {
-				k.GetResult(ctx)
+				if err := k.GetResultE(ctx); err != nil {
+					return nil, err
+				}
 			}
-			command.RunFunc(ctx)
+			return ctx, nil
 		}
-		if command.Parent == "" {
-			k.iShell.AddCmd(shellCmd)
-		} else {
-			k.iShell.AddChild(c.Parent, shellCmd)
+		runData := command.RunData
+		if runData == nil && command.RunFunc == nil && command.RunFuncE == nil && command.HandlerData != nil {
+			// render the data from server.
+			runData = func(ctx *KtrlContext) (data any, err error) {
+				err = ctx.DecodeResult(&data)
+				return
+			}
+		}
+		if runData != nil {
+			shellCmd.RunData = func(cmd *cobra.Command, args []string) (any, error) {
+				ctx, err := newContext(cmd, args)
+				if err != nil {
+					return nil, err
+				}
+				return runData(ctx)
+			}
+		} else if command.RunFunc != nil || command.RunFuncE != nil {
+			shellCmd.RunE = func(cmd *cobra.Command, args []string) error {
+				ctx, err := newContext(cmd, args)
+				if err != nil {
+					return err
+				}
+				if command.RunFuncE != nil {
+					return command.RunFuncE(ctx)
+				}
+				command.RunFunc(ctx)
+				return nil
+			}
+		}
+		shellCmd.Parent = command.Parent
+		if err := k.iShell.AddCmdE(shellCmd); err != nil {
+			gprint.Red("failed to add command %s: %s", command.GetPath(), err)
 		}
 	}
 }
 
-// Send msg to server manually.
+// Send msg to server manually, the options are sent with their defaults, see SendMsgE.
 func (k *Ktrl) SendMsg(name, parent string, options []*shell.Flag, args ...string) (r []byte) {
+	r, _ = k.SendMsgE(name, parent, options, args...)
+	return
+}
+
+// SendMsgE sends msg to server like SendMsg, an error is returned if the request or the server fails.
+func (k *Ktrl) SendMsgE(name, parent string, options []*shell.Flag, args ...string) ([]byte, error) {
 	ctx := &KtrlContext{
 		Command: nil,
 		args:    args,
@@ -173,8 +381,10 @@ func (k *Ktrl) SendMsg(name, parent string, options []*shell.Flag, args ...strin
 		Route:   FormatRoute(name, parent),
 		Type:    ContextTypeClient,
 	}
-	k.GetResult(ctx)
-	return ctx.Result
+	if err := k.GetResultE(ctx); err != nil {
+		return nil, err
+	}
+	return ctx.Result, nil
 }
 
 func (k *Ktrl) SetPrintLogo(f func(_ *console.Console)) {
@@ -185,8 +395,12 @@ func (k *Ktrl) PreShellStart() {
 	if k.iShell == nil {
 		k.iShell = shell.NewIShell()
 		k.iShell.SetHistoryFilePath(k.conf.HistoryFilePath, k.conf.MaxHistoryLines, true)
+		k.l.Lock()
+		k.iShell.Use(k.shellMiddlewares...)
+		k.l.Unlock()
 	}
 	k.addShellCmd()
+	k.iShell.OnExit(k.StopServer)
 }
 
 func (k *Ktrl) StartShell() error {
@@ -197,6 +411,19 @@ func (k *Ktrl) StartShell() error {
 	return err
 }
 
+// RunArgs executes a single cmd from args, or starts the shell if args is empty, see shell.IShell.RunArgs.
+func (k *Ktrl) RunArgs(args []string) int {
+	if k.iShell == nil {
+		k.PreShellStart()
+	}
+	return k.iShell.RunArgs(args)
+}
+
+// Main runs the cmd from os.Args, or the shell if no cmd is given, and exits the process with the exit status.
+func (k *Ktrl) Main() {
+	os.Exit(k.RunArgs(os.Args[1:]))
+}
+
 /*
 server
 */
@@ -211,15 +438,34 @@ func (k *Ktrl) addServerHandlers() {
 	k.initEngine()
 	for _, c := range k.commands {
 		command := c // replicate, in case "c" will be covered.
-		ctx := &KtrlContext{
-			Route:   command.GetRoute(),
-			Options: command.Options,
-			Type:    ContextTypeServer,
+		if command.Handler == nil && command.HandlerE == nil && command.HandlerData == nil {
+			continue
+		}
+		options := k.getOptions(command)
+		handle := k.chain(command)
+		handler := func(gctx *gin.Context) {
+			ctx := &KtrlContext{
+				GinCtx:  gctx,
+				Route:   command.GetRoute(),
+				Options: options,
+				Type:    ContextTypeServer,
+			}
+			err := shell.ValidateFlags(options, command.MutuallyExclusive, command.RequiredTogether, &queryFlagSource{gctx})
+			if err == nil {
+				err = shell.ValidateArgs(command.Args, ctx.GetArgs())
+			}
+			if err != nil {
+				ctx.SendResponse(err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := handle(ctx); err != nil && !gctx.Writer.Written() {
+				ctx.SendResponse(err.Error(), http.StatusInternalServerError)
+			}
+		}
+		k.engine.GET(command.GetRoute(), handler)
+		for _, route := range command.GetAliasRoutes() {
+			k.engine.GET(route, handler)
 		}
-		k.engine.GET(ctx.Route, func(gctx *gin.Context) {
-			ctx.GinCtx = gctx
-			command.Handler(ctx)
-		})
 	}
 	// Check if server is running.
 	k.engine.GET(PingRoute, func(gctx *gin.Context) {
@@ -255,7 +501,14 @@ func (k *Ktrl) listen() error {
 			return err
 		}
 	}
-	return http.Serve(listener, k.engine)
+	k.l.Lock()
+	k.server = &http.Server{Handler: k.engine}
+	server := k.server
+	k.l.Unlock()
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 func (k *Ktrl) PreServerStart() {
@@ -266,9 +519,32 @@ func (k *Ktrl) PreServerStart() {
 	k.addServerHandlers()
 }
 
+// StartServer serves until StopServer is called, see StartServerE.
 func (k *Ktrl) StartServer() {
+	k.StartServerE()
+}
+
+// StartServerE serves like StartServer, an error is returned if the server cannot listen or fails.
+func (k *Ktrl) StartServerE() error {
 	if k.engine == nil {
 		k.PreServerStart()
 	}
-	k.listen()
+	return k.listen()
+}
+
+/*
+StopServer gracefully shuts down the server, waiting up to ShutdownTimeout for handlers to return.
+It is called when the shell started by StartShell exits.
+*/
+func (k *Ktrl) StopServer() error {
+	k.l.Lock()
+	server := k.server
+	k.server = nil
+	k.l.Unlock()
+	if server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
 }
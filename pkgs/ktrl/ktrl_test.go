@@ -0,0 +1,339 @@
+package ktrl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gvcgo/gshell/pkgs/shell"
+)
+
+// newTestKtrl serves the cmds with an httptest server, and returns the shell of the client and the server URL.
+func newTestKtrl(t *testing.T, cmds ...*KtrlCommand) (*shell.IShell, string) {
+	k := NewKtrl(&KtrlConf{HistoryFilePath: filepath.Join(t.TempDir(), "history")})
+	for _, c := range cmds {
+		k.AddCommand(c)
+	}
+	k.PreServerStart()
+	server := httptest.NewServer(k.engine)
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.conf.ServerHost = host
+	if k.conf.ServerPort, err = strconv.Atoi(port); err != nil {
+		t.Fatal(err)
+	}
+	k.PreShellStart()
+	return k.GetShell(), server.URL
+}
+
+// runLine runs a line in the shell, and returns its output and error output.
+func runLine(sh *shell.IShell, line string) (out, errOut string, err error) {
+	o, e := &bytes.Buffer{}, &bytes.Buffer{}
+	err = sh.RunLineWith(line, strings.NewReader(""), o, e)
+	return o.String(), e.String(), err
+}
+
+func TestNewStructCommand(t *testing.T) {
+	type options struct {
+		Level int    `flag:"level" type:"string" default:"1"`
+		Name  string `arg:"name"`
+	}
+	var handled int
+	show, err := NewStructCommand("show", nil, func(ctx *KtrlContext, opts *options) error {
+		handled++
+		ctx.SendResponse(strings.Repeat(opts.Name, opts.Level))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh, _ := newTestKtrl(t, show)
+	tests := []struct {
+		line    string
+		out     string
+		handled int
+		wantErr bool
+	}{
+		{line: "show a", out: "a\n", handled: 1},
+		{line: "show a --level 3", out: "aaa\n", handled: 2},
+		// T cannot be populated on client side, the request is not sent.
+		{line: "show a --level high", handled: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		out, errOut, err := runLine(sh, tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("RunLineWith(%q) = %v, want error %v, stderr: %s", tt.line, err, tt.wantErr, errOut)
+		}
+		if out != tt.out || handled != tt.handled {
+			t.Errorf("RunLineWith(%q) output %q, handled %d times, want %q, %d", tt.line, out, handled, tt.out, tt.handled)
+		}
+	}
+}
+
+// printResult is the RunFunc of the cmds printing the result from server.
+func printResult(ctx *KtrlContext) {
+	ctx.PrintResult()
+}
+
+// sendJSON returns a Handler sending the values returned by values as JSON.
+func sendJSON(values func(ctx *KtrlContext) map[string]any) func(ctx *KtrlContext) {
+	return func(ctx *KtrlContext) {
+		b, err := json.Marshal(values(ctx))
+		if err != nil {
+			ctx.SendResponse(err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ctx.SendResponse(b)
+	}
+}
+
+func TestQueryEncoding(t *testing.T) {
+	show := &KtrlCommand{
+		Name: "show",
+		Options: []*shell.Flag{
+			{Name: "name", Type: shell.OptionTypeString},
+			{Name: "tags", Type: shell.OptionTypeStringSlice},
+			{Name: "ids", Type: shell.OptionTypeIntSlice},
+			{Name: "labels", Type: shell.OptionTypeStringMap},
+			{Name: "size", Type: shell.OptionTypeUint},
+			{Name: "offset", Type: shell.OptionTypeInt64},
+			{Name: "wait", Type: shell.OptionTypeDuration},
+			{Name: "verbose", Short: "v", Type: shell.OptionTypeCount},
+		},
+		RunFunc: printResult,
+		Handler: sendJSON(func(ctx *KtrlContext) map[string]any {
+			return map[string]any{
+				"name":    ctx.GetString("name"),
+				"tags":    ctx.GetStringSlice("tags"),
+				"ids":     ctx.GetIntSlice("ids"),
+				"labels":  ctx.GetStringMap("labels"),
+				"size":    ctx.GetUint("size"),
+				"offset":  ctx.GetInt64("offset"),
+				"wait":    ctx.GetDuration("wait").String(),
+				"verbose": ctx.GetCount("verbose"),
+				"args":    ctx.GetArgs(),
+			}
+		}),
+	}
+	sh, _ := newTestKtrl(t, show)
+	tests := []struct {
+		line string
+		want map[string]any
+	}{
+		{
+			line: `show --name "a,b&c=d" --tags '"x,y",z' --tags w --ids 1,2 --labels k=v,l=w --size 3 --offset -4 --wait 1m -vv "e,f" "g h"`,
+			want: map[string]any{
+				"name":    "a,b&c=d",
+				"tags":    []any{"x,y", "z", "w"},
+				"ids":     []any{1.0, 2.0},
+				"labels":  map[string]any{"k": "v", "l": "w"},
+				"size":    3.0,
+				"offset":  -4.0,
+				"wait":    "1m0s",
+				"verbose": 2.0,
+				"args":    []any{"e,f", "g h"},
+			},
+		},
+		{
+			line: `show , --name ""`,
+			want: map[string]any{
+				"name":    "",
+				"tags":    nil,
+				"ids":     []any{},
+				"labels":  map[string]any{},
+				"size":    0.0,
+				"offset":  0.0,
+				"wait":    "0s",
+				"verbose": 0.0,
+				"args":    []any{","},
+			},
+		},
+	}
+	for _, tt := range tests {
+		out, errOut, err := runLine(sh, tt.line)
+		if err != nil {
+			t.Fatalf("RunLineWith(%q) = %v, stderr: %s", tt.line, err, errOut)
+		}
+		var got map[string]any
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("RunLineWith(%q) output %q: %v", tt.line, out, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RunLineWith(%q) sent %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestForwardFlags(t *testing.T) {
+	netCmd := &KtrlCommand{
+		Name:              "net",
+		PersistentOptions: []*shell.Flag{{Name: "verbose", Short: "v", Type: shell.OptionTypeBool}},
+	}
+	route := &KtrlCommand{
+		Name:              "route",
+		Parent:            "net",
+		PersistentOptions: []*shell.Flag{{Name: "table", Type: shell.OptionTypeString, Default: "main"}},
+	}
+	add := &KtrlCommand{
+		Name:    "add",
+		Parent:  "net.route",
+		Options: []*shell.Flag{{Name: "metric", Type: shell.OptionTypeInt, Default: "10"}},
+		RunFunc: printResult,
+		Handler: sendJSON(func(ctx *KtrlContext) map[string]any {
+			return map[string]any{
+				"verbose": ctx.GetBool("verbose"),
+				"table":   ctx.GetString("table"),
+				"metric":  ctx.GetInt("metric"),
+				"query":   ctx.GinCtx.Request.URL.RawQuery,
+			}
+		}),
+	}
+	sh, _ := newTestKtrl(t, add, route, netCmd)
+	tests := []struct {
+		line string
+		want map[string]any
+	}{
+		{
+			// the flags not set are not sent, the server falls back to their defaults.
+			line: "net route add",
+			want: map[string]any{"verbose": false, "table": "main", "metric": 10.0, "query": ""},
+		},
+		{
+			line: "net route add --metric 1",
+			want: map[string]any{"verbose": false, "table": "main", "metric": 1.0, "query": "metric=1"},
+		},
+		{
+			line: "net route add -v --table local",
+			want: map[string]any{"verbose": true, "table": "local", "metric": 10.0, "query": "table=local&verbose=true"},
+		},
+		{
+			line: "net route add --metric 10",
+			want: map[string]any{"verbose": false, "table": "main", "metric": 10.0, "query": "metric=10"},
+		},
+	}
+	for _, tt := range tests {
+		out, errOut, err := runLine(sh, tt.line)
+		if err != nil {
+			t.Fatalf("RunLineWith(%q) = %v, stderr: %s", tt.line, err, errOut)
+		}
+		var got map[string]any
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("RunLineWith(%q) output %q: %v", tt.line, out, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RunLineWith(%q) sent %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAliasRoutes(t *testing.T) {
+	netCmd := &KtrlCommand{Name: "net", Aliases: []string{"n"}}
+	route := &KtrlCommand{
+		Name:              "route",
+		Parent:            "net",
+		Aliases:           []string{"rt"},
+		DeprecatedAliases: []string{"r"},
+		RunFunc:           printResult,
+		Handler: func(ctx *KtrlContext) {
+			ctx.SendResponse(ctx.Route)
+		},
+	}
+	sh, url := newTestKtrl(t, netCmd, route)
+	tests := []struct {
+		line   string
+		errOut string
+	}{
+		{line: "net route"},
+		{line: "n rt"},
+		{line: "net r", errOut: "Command \"r\" is deprecated, use \"route\" instead\n"},
+	}
+	for _, tt := range tests {
+		out, errOut, err := runLine(sh, tt.line)
+		if err != nil || out != "/net/route/\n" || errOut != tt.errOut {
+			t.Errorf("RunLineWith(%q) = %v, output %q, %q, want %q, %q", tt.line, err, out, errOut, "/net/route/\n", tt.errOut)
+		}
+	}
+	// routes are served for the aliases, eg: for clients calling the cmd by an old name.
+	for route, status := range map[string]int{
+		"/net/route/": http.StatusOK,
+		"/net/rt/":    http.StatusOK,
+		"/net/r/":     http.StatusOK,
+		"/net/x/":     http.StatusNotFound,
+	} {
+		resp, err := http.Get(url + route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("GET %s status %d, want %d", route, resp.StatusCode, status)
+		}
+	}
+}
+
+func TestServerValidation(t *testing.T) {
+	var handled int
+	add := &KtrlCommand{
+		Name: "add",
+		Options: []*shell.Flag{
+			{Name: "dev", Type: shell.OptionTypeString, Required: true},
+			{Name: "proto", Type: shell.OptionTypeString, Choices: []string{"tcp", "udp"}},
+			{Name: "metric", Type: shell.OptionTypeInt, Min: "0", Max: "100"},
+			{Name: "gw", Type: shell.OptionTypeString},
+			{Name: "blackhole", Type: shell.OptionTypeBool},
+		},
+		MutuallyExclusive: [][]string{{"gw", "blackhole"}},
+		Args:              []*shell.Arg{{Name: "port", Type: shell.OptionTypeInt}},
+		Handler: func(ctx *KtrlContext) {
+			handled++
+			ctx.SendResponse("ok")
+		},
+	}
+	_, url := newTestKtrl(t, add)
+	tests := []struct {
+		query  string
+		status int
+		err    error
+	}{
+		{"dev=eth0&queryArgs=80", http.StatusOK, nil},
+		{"queryArgs=80", http.StatusBadRequest, shell.ErrFlagRequired},
+		{"dev=eth0&proto=icmp&queryArgs=80", http.StatusBadRequest, shell.ErrFlagInvalid},
+		{"dev=eth0&metric=101&queryArgs=80", http.StatusBadRequest, shell.ErrFlagInvalid},
+		{"dev=eth0&gw=a&blackhole=true&queryArgs=80", http.StatusBadRequest, shell.ErrFlagExclusive},
+		{"dev=eth0&queryArgs=http", http.StatusBadRequest, shell.ErrArgInvalid},
+		{"dev=eth0", http.StatusBadRequest, shell.ErrArgCount},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(url + "/add/?" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the error is sent back in the body, the handler is not called.
+		want := "ok"
+		if tt.err != nil {
+			want = tt.err.Error()
+		}
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), want) {
+			t.Errorf("GET ?%s status %d, body %q, want %d, %q", tt.query, resp.StatusCode, body, tt.status, want)
+		}
+	}
+	if handled != 1 {
+		t.Errorf("handled %d times, want 1", handled)
+	}
+}
@@ -0,0 +1,197 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/rsteube/carapace"
+	"github.com/spf13/cobra"
+)
+
+const (
+	AliasFileName string = ".gshell_aliases" // saved next to the history file
+)
+
+var (
+	ErrAliasInvalid  = errors.New("invalid alias name")
+	ErrAliasNotFound = errors.New("alias not found")
+)
+
+// SetAliasFilePath sets the file to load and save aliases, aliases are not saved if fPath is empty.
+func (s *IShell) SetAliasFilePath(fPath string) error {
+	aliases := map[string]string{}
+	if fPath != "" {
+		content, err := os.ReadFile(fPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(content) > 0 {
+			if err := json.Unmarshal(content, &aliases); err != nil {
+				return fmt.Errorf("parsing alias file %s: %w", fPath, err)
+			}
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.aliasFile = fPath
+	s.aliases = aliases
+	return nil
+}
+
+// SetAlias defines an alias expanded to value when used as the first word of a cmd.
+func (s *IShell) SetAlias(name, value string) error {
+	if name == "" || strings.ContainsAny(name, "= \t'\"") {
+		return fmt.Errorf("%w: %q", ErrAliasInvalid, name)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.aliases[name] = value
+	return s.saveAliases()
+}
+
+// DeleteAlias deletes an alias.
+func (s *IShell) DeleteAlias(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.aliases[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrAliasNotFound, name)
+	}
+	delete(s.aliases, name)
+	return s.saveAliases()
+}
+
+// Aliases returns a copy of the aliases.
+func (s *IShell) Aliases() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	aliases := make(map[string]string, len(s.aliases))
+	for name, value := range s.aliases {
+		aliases[name] = value
+	}
+	return aliases
+}
+
+func (s *IShell) saveAliases() error {
+	if s.aliasFile == "" {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.aliases); err != nil {
+		return err
+	}
+	return os.WriteFile(s.aliasFile, buf.Bytes(), 0666)
+}
+
+/*
+expandAlias returns the line an alias expands to, when args[0] is an alias which is not being expanded.
+The rest args are quoted and appended to the alias value.
+*/
+func (s *IShell) expandAlias(args []string, st execState) (name, line string, ok bool) {
+	if len(args) == 0 || slices.Contains(st.expanding, args[0]) {
+		return
+	}
+	s.lock.RLock()
+	value, ok := s.aliases[args[0]]
+	s.lock.RUnlock()
+	if !ok {
+		return
+	}
+	return args[0], strings.TrimSpace(value + " " + shellquote.Join(args[1:]...)), true
+}
+
+// runAlias executes the line an alias expands to, the alias is not expanded again in the line.
+func (s *IShell) runAlias(name, line string, st execState) error {
+	st.expanding = append(slices.Clip(st.expanding), name)
+	return s.runLine(line, st)
+}
+
+func sortedKeys(aliases map[string]string) []string {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newAliasCmds returns the builtin cmds to define, list and delete aliases.
+func (s *IShell) newAliasCmds() []*cobra.Command {
+	aliasCmd := &cobra.Command{
+		Use:   "alias [name[=value]...]",
+		Short: "Define or list aliases.",
+		Long: `Define or list aliases, eg:
+  alias st='show --enable'  define an alias
+  alias st                  show an alias
+  alias                     list aliases`,
+		GroupID: BuiltinGroup.ID,
+		// the value of an alias may contain flags.
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+				return cmd.Help()
+			}
+			aliases := s.Aliases()
+			if len(args) == 0 {
+				for _, name := range sortedKeys(aliases) {
+					cmd.Printf("alias %s=%s\n", name, shellquote.Join(aliases[name]))
+				}
+				return nil
+			}
+			// every arg defines or shows an alias, like bash.
+			for _, arg := range args {
+				if name, value, ok := strings.Cut(arg, "="); ok {
+					if err := s.SetAlias(name, value); err != nil {
+						return err
+					}
+					continue
+				}
+				value, ok := aliases[arg]
+				if !ok {
+					return fmt.Errorf("%w: %s", ErrAliasNotFound, arg)
+				}
+				cmd.Printf("alias %s=%s\n", arg, shellquote.Join(value))
+			}
+			return nil
+		},
+	}
+
+	unaliasCmd := &cobra.Command{
+		Use:     "unalias <name>...",
+		Short:   "Delete aliases.",
+		GroupID: BuiltinGroup.ID,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				if err := s.DeleteAlias(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	carapace.Gen(unaliasCmd).PositionalAnyCompletion(carapace.ActionCallback(func(c carapace.Context) carapace.Action {
+		aliases := s.Aliases()
+		described := []string{}
+		for _, name := range sortedKeys(aliases) {
+			described = append(described, name, aliases[name])
+		}
+		return carapace.ActionValuesDescribed(described...).Filter(c.Args...)
+	}))
+	return []*cobra.Command{aliasCmd, unaliasCmd}
+}
+
+// aliasFilePath returns the alias file next to a history file.
+func aliasFilePath(historyFile string) string {
+	return filepath.Join(filepath.Dir(historyFile), AliasFileName)
+}
@@ -0,0 +1,51 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAliasCmd(t *testing.T) {
+	s := newTestShell(t)
+	if err := s.SetAliasFilePath(filepath.Join(t.TempDir(), AliasFileName)); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := s.RunLineWith("alias a=x 'b=say y' c=", strings.NewReader(""), out, out); err != nil {
+		t.Fatalf("alias = %v, output %q", err, out)
+	}
+	want := map[string]string{"a": "x", "b": "say y", "c": ""}
+	if got := s.Aliases(); !maps.Equal(got, want) {
+		t.Errorf("Aliases() = %q, want %q", got, want)
+	}
+	out.Reset()
+	if err := s.RunLineWith("alias a b", strings.NewReader(""), out, out); err != nil || out.String() != "alias a=x\nalias b='say y'\n" {
+		t.Errorf("alias a b = %v, output %q", err, out)
+	}
+	out.Reset()
+	if err := s.RunLineWith("b z", strings.NewReader(""), out, out); err != nil || out.String() != "y z\n" {
+		t.Errorf("b z = %v, output %q", err, out)
+	}
+	if err := s.RunLineWith("alias d", strings.NewReader(""), out, out); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("alias d = %v, want %v", err, ErrAliasNotFound)
+	}
+}
+
+func TestSetHistoryFilePathAliasError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, AliasFileName), []byte("{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	s := NewIShell()
+	if err := s.SetHistoryFilePathE(filepath.Join(dir, ".history"), 10); err == nil {
+		t.Error("SetHistoryFilePathE() with a corrupt alias file = nil, want an error")
+	}
+	if s.History == nil {
+		t.Error("SetHistoryFilePathE() with a corrupt alias file did not set the history")
+	}
+}
@@ -0,0 +1,120 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrArgCount   = errors.New("wrong number of args")
+	ErrArgInvalid = errors.New("invalid arg value")
+)
+
+/*
+Positional args
+*/
+type Arg struct {
+	Name      string     // arg name, shown in usage line
+	Type      FlagType   // arg type, string by default
+	Usage     string     // arg help info
+	Optional  bool       // arg can be omitted, only trailing args can be optional
+	Variadic  bool       // arg takes all the remaining values, must be the last one
+	Choices   []string   // allowed values, also used for completion
+	Completer *Completer // completion for the arg, Choices are completed if nil
+}
+
+func (a *Arg) String() string {
+	name := a.Name
+	if a.Variadic {
+		name += "..."
+	}
+	if a.Optional {
+		return fmt.Sprintf("[%s]", name)
+	}
+	return fmt.Sprintf("<%s>", name)
+}
+
+// ArgsUsage returns the usage line of args, eg: "<host> [port] [files...]".
+func ArgsUsage(specs []*Arg) string {
+	strs := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		strs = append(strs, spec.String())
+	}
+	return strings.Join(strs, " ")
+}
+
+// ArgsHelp returns the help info of args, empty if no arg has a usage.
+func ArgsHelp(specs []*Arg) string {
+	width, hasUsage := 0, false
+	for _, spec := range specs {
+		width = max(width, len(spec.Name))
+		hasUsage = hasUsage || spec.Usage != ""
+	}
+	if !hasUsage {
+		return ""
+	}
+	lines := []string{"Arguments:"}
+	for _, spec := range specs {
+		lines = append(lines, fmt.Sprintf("  %-*s   %s", width, spec.Name, spec.Usage))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ArgsRange returns the min and max number of args, max is -1 for variadic args.
+func ArgsRange(specs []*Arg) (minArgs, maxArgs int) {
+	for _, spec := range specs {
+		if !spec.Optional {
+			minArgs++
+		}
+		if spec.Variadic {
+			maxArgs = -1
+		} else if maxArgs >= 0 {
+			maxArgs++
+		}
+	}
+	return
+}
+
+func checkArg(spec *Arg, value string) (err error) {
+	switch spec.Type {
+	case OptionTypeBool:
+		_, err = strconv.ParseBool(value)
+	case OptionTypeInt, OptionTypeInt64:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case OptionTypeUint:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case OptionTypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case OptionTypeDuration:
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s=%s (not a valid %s)", ErrArgInvalid, spec.Name, value, spec.Type)
+	}
+	if len(spec.Choices) > 0 && !slices.Contains(spec.Choices, value) {
+		return fmt.Errorf("%w: %s=%s (allowed: %s)", ErrArgInvalid, spec.Name, value, strings.Join(spec.Choices, ", "))
+	}
+	return nil
+}
+
+// ValidateArgs checks the number and the values of args, no check is done when specs is nil.
+func ValidateArgs(specs []*Arg, args []string) error {
+	if specs == nil {
+		return nil
+	}
+	minArgs, maxArgs := ArgsRange(specs)
+	if len(args) < minArgs || (maxArgs >= 0 && len(args) > maxArgs) {
+		return fmt.Errorf("%w: %s expected, received %d", ErrArgCount, ArgsUsage(specs), len(args))
+	}
+	for i, value := range args {
+		spec := specs[min(i, len(specs)-1)]
+		if err := checkArg(spec, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package shell
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateArgs(t *testing.T) {
+	specs := []*Arg{
+		{Name: "host"},
+		{Name: "port", Type: OptionTypeInt, Optional: true},
+		{Name: "mode", Optional: true, Choices: []string{"tcp", "udp"}},
+	}
+	variadic := []*Arg{
+		{Name: "op", Choices: []string{"add", "del"}},
+		{Name: "ids", Type: OptionTypeInt, Variadic: true, Optional: true},
+	}
+	tests := []struct {
+		name  string
+		specs []*Arg
+		args  []string
+		want  error
+	}{
+		{"nil specs", nil, []string{"any", "thing"}, nil},
+		{"required only", specs, []string{"a"}, nil},
+		{"all", specs, []string{"a", "80", "udp"}, nil},
+		{"missing", specs, nil, ErrArgCount},
+		{"too many", specs, []string{"a", "80", "udp", "x"}, ErrArgCount},
+		{"not an int", specs, []string{"a", "http"}, ErrArgInvalid},
+		{"not a choice", specs, []string{"a", "80", "icmp"}, ErrArgInvalid},
+		{"variadic empty", variadic, []string{"add"}, nil},
+		{"variadic many", variadic, []string{"del", "1", "2", "3"}, nil},
+		{"variadic invalid", variadic, []string{"del", "1", "x"}, ErrArgInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateArgs(tt.specs, tt.args)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("ValidateArgs(%q) = %v, want %v", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgsUsage(t *testing.T) {
+	specs := []*Arg{{Name: "host"}, {Name: "port", Optional: true}, {Name: "files", Variadic: true, Optional: true}}
+	if got, want := ArgsUsage(specs), "<host> [port] [files...]"; got != want {
+		t.Errorf("ArgsUsage() = %q, want %q", got, want)
+	}
+	if minArgs, maxArgs := ArgsRange(specs); minArgs != 1 || maxArgs != -1 {
+		t.Errorf("ArgsRange() = %d, %d, want 1, -1", minArgs, maxArgs)
+	}
+}
@@ -1,15 +1,46 @@
 package shell
 
-import "github.com/spf13/cobra"
+import (
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	CmdPathSep string = "."
+)
+
+// CmdGroup sections cmds in help output.
+type CmdGroup struct {
+	ID    string // group id
+	Title string // group title in help output
+	Order int    // groups are sorted by Order in help output
+}
 
 type ShellCmd struct {
-	Name        string  // cmd name
-	Parent      string  // parent cmd name
-	HelpStr     string  // Short for cobra cmd
-	LongHelpStr string  // Long for cobra cmd
-	Options     []*Flag // flags for cobra
-	Run         func(cmd *cobra.Command, args []string)
-	Children    []*ShellCmd
+	Name              string                                               // cmd name
+	Aliases           []string                                             // other names of the cmd
+	DeprecatedAliases []string                                             // old names of the cmd, still working with a deprecation warning
+	Hidden            bool                                                 // hide the cmd from help and completion
+	Deprecated        string                                               // deprecation notice, eg: `use "net route" instead`
+	Group             *CmdGroup                                            // group in help output of the parent cmd
+	Parent            string                                               // parent cmd path, eg: "net.route"
+	HelpStr           string                                               // Short for cobra cmd
+	LongHelpStr       string                                               // Long for cobra cmd
+	Options           []*Flag                                              // flags for cobra
+	PersistentOptions []*Flag                                              // flags inherited by all descendants
+	Args              []*Arg                                               // positional args, nil for any args
+	Completer         *Completer                                           // completion for any positional args when Args is nil
+	MutuallyExclusive [][]string                                           // groups of flags that cannot be used together
+	RequiredTogether  [][]string                                           // groups of flags that must be used together
+	Run               func(cmd *cobra.Command, args []string)              // cmd.Context() is cancelled on Ctrl-C
+	RunE              func(cmd *cobra.Command, args []string) error        // used instead of Run if not nil
+	RunData           func(cmd *cobra.Command, args []string) (any, error) // used instead of RunE if not nil, the data is rendered as selected by --output
+	Columns           []string                                             // default columns of table output for RunData
+	NoPager           bool                                                 // never show the output in the pager, eg: for cmds streaming output
+	Filters           []string                                             // the cmd is unavailable while one of them is hidden by Console.HideCommands
+	Children          []*ShellCmd
 }
 
 func NewShellCmd() (sc *ShellCmd) {
@@ -19,6 +50,65 @@ func NewShellCmd() (sc *ShellCmd) {
 	return
 }
 
+// Path returns the full path of the cmd, eg: "net.route.add".
+func (s *ShellCmd) Path() string {
+	return GetFlagKey(s.Parent, s.Name)
+}
+
+// AddChild adds a child cmd, the Parent of the whole child tree is updated.
 func (s *ShellCmd) AddChild(child *ShellCmd) {
+	child.setParent(s.Path())
 	s.Children = append(s.Children, child)
 }
+
+// IsDeprecatedAlias reports whether name is an old name of the cmd.
+func (s *ShellCmd) IsDeprecatedAlias(name string) bool {
+	for _, alias := range s.DeprecatedAliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// options returns the local flags of the cmd, including the output flags if the cmd returns data.
+// inherited are the persistent flags of the cmd and its ancestors, the output flags never take their names or shorthands.
+func (s *ShellCmd) options(inherited []*Flag) []*Flag {
+	if s.RunData == nil {
+		return s.Options
+	}
+	taken := append(append([]*Flag{}, s.Options...), inherited...)
+	opts := append([]*Flag{}, s.Options...)
+	for _, opt := range outputOptions() {
+		if slices.ContainsFunc(taken, func(o *Flag) bool { return o.Name == opt.Name }) {
+			continue
+		}
+		if opt.Short != "" && slices.ContainsFunc(taken, func(o *Flag) bool { return o.Short == opt.Short }) {
+			opt.Short = ""
+		}
+		opts = append(opts, opt)
+	}
+	return opts
+}
+
+func (s *ShellCmd) setParent(parent string) {
+	s.Parent = parent
+	for _, child := range s.Children {
+		child.setParent(s.Path())
+	}
+}
+
+// Find returns a descendant cmd by path relative to the current cmd, eg: "route.add".
+func (s *ShellCmd) Find(path string) *ShellCmd {
+	name, rest, _ := strings.Cut(path, CmdPathSep)
+	for _, child := range s.Children {
+		if child.Name != name {
+			continue
+		}
+		if rest == "" {
+			return child
+		}
+		return child.Find(rest)
+	}
+	return nil
+}
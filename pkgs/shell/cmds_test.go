@@ -0,0 +1,101 @@
+package shell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestOutputFlagShorthand(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []*Flag
+		inherited []*Flag
+		line      string
+		want      string
+	}{
+		{
+			name: "free shorthand",
+			line: "list -o json",
+			want: `"name": "a"`,
+		},
+		{
+			name:    "local shorthand",
+			options: []*Flag{{Name: "overwrite", Short: "o", Type: OptionTypeBool}},
+			line:    "list -o --output json",
+			want:    `"name": "a"`,
+		},
+		{
+			name:      "inherited shorthand",
+			inherited: []*Flag{{Name: "owner", Short: "o", Type: OptionTypeString}},
+			line:      "parent list -o bob --output text",
+			want:      "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewIShell()
+			list := NewShellCmd()
+			list.Name = "list"
+			list.Options = tt.options
+			list.RunData = func(cmd *cobra.Command, args []string) (any, error) {
+				return []map[string]string{{"name": "a"}}, nil
+			}
+			if tt.inherited != nil {
+				parent := NewShellCmd()
+				parent.Name = "parent"
+				parent.PersistentOptions = tt.inherited
+				parent.AddChild(list)
+				list = parent
+			}
+			if err := s.AddCmdE(list); err != nil {
+				t.Fatal(err)
+			}
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			if err := s.RunLineWith(tt.line, strings.NewReader(""), out, errOut); err != nil {
+				t.Fatalf("RunLineWith(%q) = %v, stderr: %s", tt.line, err, errOut)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("RunLineWith(%q) output %q, want %q", tt.line, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeprecationNotice(t *testing.T) {
+	tests := []struct {
+		line   string
+		errOut string
+	}{
+		{"route", ""},
+		{"rt", "Command \"rt\" is deprecated, use \"route\" instead\n"},
+		{"old", "Command \"old\" is deprecated, use \"route\" instead\n"},
+	}
+	s := newTestShell(t)
+	route := NewShellCmd()
+	route.Name = "route"
+	route.DeprecatedAliases = []string{"rt"}
+	old := NewShellCmd()
+	old.Name = "old"
+	old.Deprecated = `use "route" instead`
+	for _, c := range []*ShellCmd{route, old} {
+		c.Run = func(cmd *cobra.Command, args []string) {
+			cmd.Println("ok")
+		}
+		if err := s.AddCmdE(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := s.RunLineWith(tt.line+" | upper", strings.NewReader(""), out, errOut); err != nil {
+			t.Fatalf("RunLineWith(%q) = %v", tt.line, err)
+		}
+		// the notice is not piped.
+		if out.String() != "OK\n" || errOut.String() != tt.errOut {
+			t.Errorf("RunLineWith(%q) output %q, %q, want %q, %q", tt.line, out, errOut, "OK\n", tt.errOut)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"github.com/rsteube/carapace"
+)
+
+/*
+Completer describes how to complete a flag or a positional arg.
+Several kinds of completion can be combined.
+*/
+type Completer struct {
+	Values   []string                                   // static values
+	Files    bool                                       // complete file paths
+	Exts     []string                                   // complete file paths with extensions, eg: ".go"
+	Dirs     bool                                       // complete directories
+	Callback func(value string, args []string) []string // dynamic values, value is the word being completed
+}
+
+func CompleteValues(values ...string) *Completer {
+	return &Completer{Values: values}
+}
+
+func CompleteFiles(exts ...string) *Completer {
+	return &Completer{Files: true, Exts: exts}
+}
+
+func CompleteDirs() *Completer {
+	return &Completer{Dirs: true}
+}
+
+func CompleteFunc(f func(value string, args []string) []string) *Completer {
+	return &Completer{Callback: f}
+}
+
+// Action converts the Completer to a carapace action.
+func (c *Completer) Action() carapace.Action {
+	actions := []carapace.Action{}
+	if len(c.Values) > 0 {
+		actions = append(actions, carapace.ActionValues(c.Values...))
+	}
+	if c.Files || len(c.Exts) > 0 {
+		actions = append(actions, carapace.ActionFiles(c.Exts...))
+	}
+	if c.Dirs {
+		actions = append(actions, carapace.ActionDirectories())
+	}
+	if c.Callback != nil {
+		callback := c.Callback
+		actions = append(actions, carapace.ActionCallback(func(ctx carapace.Context) carapace.Action {
+			return carapace.ActionValues(callback(ctx.Value, ctx.Args)...)
+		}))
+	}
+	if len(actions) == 1 {
+		return actions[0]
+	}
+	return carapace.Batch(actions...).ToA()
+}
+
+// getCompleter returns the explicit Completer, or a Completer for the choices.
+func getCompleter(completer *Completer, choices []string) *Completer {
+	if completer == nil && len(choices) > 0 {
+		return CompleteValues(choices...)
+	}
+	return completer
+}
@@ -1,6 +1,10 @@
 package shell
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 func GetFlagKey(parent, child string) string {
 	if parent == "" && child != "" {
@@ -14,12 +18,58 @@ func GetFlagKey(parent, child string) string {
 type FlagType string
 
 const (
-	OptionTypeString FlagType = "string"
-	OptionTypeBool   FlagType = "bool"
-	OptionTypeInt    FlagType = "int"
-	OptionTypeFloat  FlagType = "float"
+	OptionTypeString      FlagType = "string"
+	OptionTypeBool        FlagType = "bool"
+	OptionTypeInt         FlagType = "int"
+	OptionTypeFloat       FlagType = "float"
+	OptionTypeUint        FlagType = "uint"
+	OptionTypeInt64       FlagType = "int64"
+	OptionTypeDuration    FlagType = "duration"    // default like "1m30s"
+	OptionTypeCount       FlagType = "count"       // -vvv
+	OptionTypeStringSlice FlagType = "stringSlice" // default like "a,b,c"
+	OptionTypeIntSlice    FlagType = "intSlice"    // default like "1,2,3"
+	OptionTypeStringMap   FlagType = "stringMap"   // default like "a=1,b=2"
 )
 
+// IsMulti reports whether a flag of this type holds multiple values.
+func (t FlagType) IsMulti() bool {
+	switch t {
+	case OptionTypeStringSlice, OptionTypeIntSlice, OptionTypeStringMap:
+		return true
+	default:
+		return false
+	}
+}
+
+// SplitDefault splits the default value of a multi-value flag.
+func SplitDefault(def string) (r []string) {
+	for _, v := range strings.Split(def, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			r = append(r, v)
+		}
+	}
+	return
+}
+
+// ParseStringMap parses "key=value" pairs.
+func ParseStringMap(pairs []string) (r map[string]string) {
+	r = map[string]string{}
+	for _, pair := range pairs {
+		k, v, _ := strings.Cut(pair, "=")
+		r[k] = v
+	}
+	return
+}
+
+// FormatStringMap formats a map to "key=value" pairs sorted by key.
+func FormatStringMap(m map[string]string) (r []string) {
+	for k, v := range m {
+		r = append(r, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(r)
+	return
+}
+
 /*
 Flags
 */
@@ -29,14 +79,21 @@ type IShellFlag interface {
 	GetType() FlagType
 	GetDefault() string
 	GetUsage() string
+	IsRequired() bool
 }
 
 type Flag struct {
-	Name    string   // flag name
-	Short   string   // flag shorthand
-	Type    FlagType // flag type
-	Default string   // default value
-	Usage   string   // flag help info
+	Name      string     // flag name
+	Short     string     // flag shorthand
+	Type      FlagType   // flag type
+	Default   string     // default value
+	Usage     string     // flag help info
+	Required  bool       // flag must be set by user
+	Choices   []string   // allowed values, also used for completion
+	Min       string     // min value for numbers and durations, empty for no limit
+	Max       string     // max value for numbers and durations, empty for no limit
+	Pattern   string     // regexp the value must match
+	Completer *Completer // completion for the flag value, Choices are completed if nil
 }
 
 func (f *Flag) GetName() string {
@@ -58,3 +115,7 @@ func (f *Flag) GetDefault() string {
 func (f *Flag) GetUsage() string {
 	return f.Usage
 }
+
+func (f *Flag) IsRequired() bool {
+	return f.Required
+}
@@ -162,3 +162,50 @@ func (h *fileHistory) Len() int {
 func (h *fileHistory) Dump() interface{} {
 	return h.lines
 }
+
+// Items returns a copy of the history items.
+func (h *fileHistory) Items() []Item {
+	return append([]Item{}, h.lines...)
+}
+
+// Clear deletes all the history items, the history file is emptied too.
+func (h *fileHistory) Clear() error {
+	h.lines = nil
+	if !h.enableLocal {
+		return nil
+	}
+	if ok, _ := gutils.PathIsExist(h.file); !ok {
+		return nil
+	}
+	return os.WriteFile(h.file, nil, 0666)
+}
+
+// replaceLast replaces the block of the last history item, eg: with the line expanded from "!!".
+// The last item is deleted if the one before has the same block.
+func (h *fileHistory) replaceLast(block string) error {
+	if len(h.lines) == 0 {
+		return nil
+	}
+	item := &h.lines[len(h.lines)-1]
+	item.Block = block
+	dup := len(h.lines) > 1 && h.lines[len(h.lines)-2].Block == block
+	if dup {
+		h.lines = h.lines[:len(h.lines)-1]
+	}
+	if !h.enableLocal {
+		return nil
+	}
+	content, err := os.ReadFile(h.file)
+	if err != nil {
+		return err
+	}
+	sList := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if dup {
+		sList = sList[:len(sList)-1]
+	} else if itemByte, err := json.Marshal(item); err != nil {
+		return err
+	} else {
+		sList[len(sList)-1] = string(itemByte)
+	}
+	return os.WriteFile(h.file, []byte(strings.Join(sList, "\n")), 0666)
+}
@@ -0,0 +1,249 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reeflective/readline"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrNoHistory       = errors.New("no history for the menu")
+	ErrHistoryEvent    = errors.New("event not found")
+	ErrHistoryNotClear = errors.New("history cannot be cleared")
+	ErrHistoryDate     = errors.New("invalid date")
+)
+
+const (
+	HistoryDesignator string = "!"
+	HistoryTimeLayout string = "2006-01-02 15:04:05"
+)
+
+// HistoryDateLayouts are the layouts of the dates accepted by the history builtin, in local time.
+var HistoryDateLayouts = []string{HistoryTimeLayout, "2006-01-02 15:04", "2006-01-02", time.RFC3339}
+
+// history returns the history of the active menu, or nil if the menu uses the in-memory history of console.
+func (s *IShell) history() readline.History {
+	if m := s.activeMenu(); m.History != nil {
+		return m.History
+	}
+	if !s.inSubMenu() {
+		return s.History
+	}
+	return nil
+}
+
+// historyItems returns the first n items of a history, DateTime is only known for the history from SetHistoryFilePath.
+func historyItems(hist readline.History, n int) (items []Item) {
+	if fh, ok := hist.(*fileHistory); ok {
+		items = fh.Items()
+		return items[:min(n, len(items))]
+	}
+	for i := 0; i < min(n, hist.Len()); i++ {
+		block, err := hist.GetLine(i)
+		if err != nil {
+			break
+		}
+		items = append(items, Item{Index: i, Block: block})
+	}
+	return
+}
+
+/*
+expandHistory replaces the history references in a line with the items of the history before the line, like bash:
+
+	!!   the last item
+	!n   the item of Index n
+	!-n  the nth last item
+
+References in single quotes, or followed by a space, "=" or "(" are kept.
+*/
+func expandHistory(line string, hist readline.History, n int) (string, error) {
+	if !strings.Contains(line, HistoryDesignator) {
+		return line, nil
+	}
+	b := &strings.Builder{}
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '\\' && !quoted && i+1 < len(line):
+			b.WriteByte(c)
+			i++
+			c = line[i]
+		case c == '!' && !quoted:
+			ref, rest := historyRef(line[i+1:])
+			if ref == "" {
+				break
+			}
+			block, err := historyEvent(hist, n, ref)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(block)
+			i = len(line) - len(rest) - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+// historyRef returns the reference after a "!" in s, eg: "!", "12" or "-2", and the rest of s.
+func historyRef(s string) (ref, rest string) {
+	if strings.HasPrefix(s, HistoryDesignator) {
+		return HistoryDesignator, s[1:]
+	}
+	end := 0
+	if strings.HasPrefix(s, "-") {
+		end = 1
+	}
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end == 0 || s[:end] == "-" {
+		return "", s
+	}
+	return s[:end], s[end:]
+}
+
+// historyEvent returns the item of the first n items of a history referenced by ref.
+func historyEvent(hist readline.History, n int, ref string) (string, error) {
+	items := historyItems(hist, n)
+	idx := -1
+	if ref == HistoryDesignator {
+		idx = len(items) - 1
+	} else if i, err := strconv.Atoi(ref); err == nil && i < 0 {
+		idx = len(items) + i
+	} else if err == nil {
+		for j, item := range items {
+			if item.Index == i {
+				idx = j
+			}
+		}
+	}
+	if idx < 0 || idx >= len(items) {
+		return "", fmt.Errorf("%w: %s%s", ErrHistoryEvent, HistoryDesignator, ref)
+	}
+	return items[idx].Block, nil
+}
+
+// expandLine expands the history references in an input line, the history item recorded for the line is replaced by the result.
+func (s *IShell) expandLine(line string, hist readline.History, n int) (string, error) {
+	if hist == nil {
+		return line, nil
+	}
+	expanded, err := expandHistory(line, hist, n)
+	if err != nil || expanded == line {
+		return expanded, err
+	}
+	// the line is recorded unless it is the same as the last one.
+	if fh, ok := hist.(*fileHistory); ok && fh.Len() > n {
+		if err := fh.replaceLast(expanded); err != nil {
+			return "", err
+		}
+	}
+	return expanded, nil
+}
+
+// parseHistoryDate parses a date in one of HistoryDateLayouts, a date without time is the end of the day if end is true.
+func parseHistoryDate(value string, end bool) (time.Time, error) {
+	for _, layout := range HistoryDateLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		if end && layout == "2006-01-02" {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q, expected one of %s", ErrHistoryDate, value, strings.Join(HistoryDateLayouts, ", "))
+}
+
+// newHistoryCmd returns the builtin cmd listing, searching and clearing the history of the active menu.
+func (s *IShell) newHistoryCmd() *cobra.Command {
+	var (
+		last         int
+		since, until string
+	)
+	historyCmd := &cobra.Command{
+		Use:   "history [pattern]",
+		Short: "List or search the history.",
+		Long: `List the history items containing pattern, eg:
+  history --last 10             the last 10 items
+  history --since 2024-01-02    items from a date
+  !!                            execute the last item again
+  !12                           execute the item 12 again
+  !-2                           execute the item before the last one again`,
+		GroupID: BuiltinGroup.ID,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hist := s.history()
+			if hist == nil {
+				return ErrNoHistory
+			}
+			var from, to time.Time
+			var err error
+			if since != "" {
+				if from, err = parseHistoryDate(since, false); err != nil {
+					return err
+				}
+			}
+			if until != "" {
+				if to, err = parseHistoryDate(until, true); err != nil {
+					return err
+				}
+			}
+			items := []Item{}
+			for _, item := range historyItems(hist, hist.Len()) {
+				if len(args) > 0 && !strings.Contains(item.Block, args[0]) {
+					continue
+				}
+				if (!from.IsZero() && item.DateTime.Before(from)) || (!to.IsZero() && item.DateTime.After(to)) {
+					continue
+				}
+				items = append(items, item)
+			}
+			if last > 0 && len(items) > last {
+				items = items[len(items)-last:]
+			}
+			for _, item := range items {
+				if item.DateTime.IsZero() {
+					cmd.Printf("%5d  %s\n", item.Index, item.Block)
+				} else {
+					cmd.Printf("%5d  %s  %s\n", item.Index, item.DateTime.Local().Format(HistoryTimeLayout), item.Block)
+				}
+			}
+			return nil
+		},
+	}
+	historyCmd.Flags().IntVarP(&last, "last", "n", 0, "show the last n items only")
+	historyCmd.Flags().StringVar(&since, "since", "", "show the items from the date, eg: 2024-01-02 or \"2024-01-02 15:04\"")
+	historyCmd.Flags().StringVar(&until, "until", "", "show the items until the date, inclusive")
+
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Delete all the history items.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hist := s.history()
+			if hist == nil {
+				return ErrNoHistory
+			}
+			clearer, ok := hist.(interface{ Clear() error })
+			if !ok {
+				return ErrHistoryNotClear
+			}
+			return clearer.Clear()
+		},
+	}
+	historyCmd.AddCommand(clearCmd)
+	return historyCmd
+}
@@ -0,0 +1,98 @@
+package shell
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestHistory(blocks ...string) *fileHistory {
+	h := &fileHistory{}
+	for i, block := range blocks {
+		h.lines = append(h.lines, Item{Index: i, Block: block})
+	}
+	return h
+}
+
+func TestExpandHistory(t *testing.T) {
+	// the last item is the line being expanded.
+	h := newTestHistory("ls", "say a", "say b", "!!")
+	tests := []struct {
+		line string
+		want string
+		err  error
+	}{
+		{"say c", "say c", nil},
+		{"!!", "say b", nil},
+		{"!! c", "say b c", nil},
+		{"echo !1", "echo say a", nil},
+		{"!0 && !-1", "ls && say b", nil},
+		{"!!x", "say bx", nil},
+		{"say '!!'", "say '!!'", nil},
+		{`say \!!`, `say \!!`, nil},
+		{"say a!=b !", "say a!=b !", nil},
+		{"!3", "", ErrHistoryEvent},
+		{"!-4", "", ErrHistoryEvent},
+	}
+	for _, tt := range tests {
+		got, err := expandHistory(tt.line, h, 3)
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("expandHistory(%q) error %v, want %v", tt.line, err, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("expandHistory(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryEvent(t *testing.T) {
+	// items keep their Index after the history file is trimmed.
+	h := &fileHistory{lines: []Item{{Index: 5, Block: "a"}, {Index: 6, Block: "b"}, {Index: 7, Block: "c"}}}
+	tests := []struct {
+		ref  string
+		want string
+		err  error
+	}{
+		{HistoryDesignator, "c", nil},
+		{"5", "a", nil},
+		{"7", "c", nil},
+		{"-1", "c", nil},
+		{"-3", "a", nil},
+		{"0", "", ErrHistoryEvent},
+		{"-4", "", ErrHistoryEvent},
+	}
+	for _, tt := range tests {
+		got, err := historyEvent(h, h.Len(), tt.ref)
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("historyEvent(%q) error %v, want %v", tt.ref, err, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("historyEvent(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+	if _, err := historyEvent(newTestHistory(), 0, HistoryDesignator); !errors.Is(err, ErrHistoryEvent) {
+		t.Errorf("historyEvent() of empty history error %v, want %v", err, ErrHistoryEvent)
+	}
+}
+
+func TestParseHistoryDate(t *testing.T) {
+	tests := []struct {
+		value string
+		end   bool
+		want  time.Time
+	}{
+		{"2024-01-02", false, time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2024-01-02", true, time.Date(2024, 1, 2, 23, 59, 59, 999999999, time.Local)},
+		{"2024-01-02 15:04", true, time.Date(2024, 1, 2, 15, 4, 0, 0, time.Local)},
+		{"2024-01-02 15:04:05", false, time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseHistoryDate(tt.value, tt.end)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseHistoryDate(%q, %v) = %v, %v, want %v", tt.value, tt.end, got, err, tt.want)
+		}
+	}
+	if _, err := parseHistoryDate("yesterday", false); !errors.Is(err, ErrHistoryDate) {
+		t.Errorf("parseHistoryDate(%q) error %v, want %v", "yesterday", err, ErrHistoryDate)
+	}
+}
@@ -1,28 +1,84 @@
 package shell
 
 import (
-	"bufio"
-	"fmt"
+	"errors"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/reeflective/console"
+	"github.com/reeflective/readline"
 )
 
-// exitCtrlD is a custom interrupt handler to use when the shell
+const (
+	DefaultExitConfirm string = "Confirm exit (Y/y): "
+)
+
+// ErrShellExiting is returned for cmds executed after Exit, until the shell has shut down.
+var ErrShellExiting = errors.New("shell is exiting")
+
+// ExitCtrlD is a custom interrupt handler to use when the shell
 // readline receives an io.EOF error, which is returned with CtrlD.
-func ExitCtrlD(c *console.Console) {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Confirm exit (Y/y): ")
-	text, _ := reader.ReadString('\n')
-	answer := strings.TrimSpace(text)
+// The shell exits after confirmation, see SetExitConfirm.
+func (s *IShell) ExitCtrlD(c *console.Console) {
+	if s.exitConfirm != "" && !Confirm(s.exitConfirm) {
+		return
+	}
+	s.Exit()
+}
 
-	if (answer == "Y") || (answer == "y") {
+// ExitCtrlD exits the process after confirmation, without running the OnExit hooks.
+//
+// Deprecated: Start registers IShell.ExitCtrlD for Ctrl-D, which runs the OnExit hooks.
+func ExitCtrlD(c *console.Console) {
+	if Confirm(DefaultExitConfirm) {
 		os.Exit(0)
 	}
 }
 
-func SwitchMenu(c *console.Console) {
-	fmt.Println("Switching to client menu")
-	c.SwitchMenu("client")
+// Confirm asks a question with readline, and reports whether the answer is "Y" or "y".
+func Confirm(question string) bool {
+	rl := readline.NewShell()
+	rl.Prompt.Primary(func() string { return question })
+	answer, err := rl.Readline()
+	if err != nil {
+		return false
+	}
+	answer = strings.TrimSpace(answer)
+	return answer == "Y" || answer == "y"
+}
+
+// SetExitConfirm sets the confirmation prompt of ExitCtrlD, the shell exits without confirmation if prompt is empty.
+func (s *IShell) SetExitConfirm(prompt string) {
+	s.exitConfirm = prompt
+}
+
+// OnExit registers hooks to run when the shell exits, before Start returns.
+func (s *IShell) OnExit(hooks ...func() error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.exitHooks = append(s.exitHooks, hooks...)
+}
+
+// Exit stops the shell after the current cmd, Start returns once the OnExit hooks have run.
+func (s *IShell) Exit() {
+	s.exiting.Store(true)
+}
+
+// shutdown runs the OnExit hooks, errors are rendered and joined.
+func (s *IShell) shutdown() error {
+	s.exiting.Store(false)
+
+	s.lock.RLock()
+	hooks := slices.Clone(s.exitHooks)
+	s.lock.RUnlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(); err != nil {
+			s.renderError(os.Stderr, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,77 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestShellExiting(t *testing.T) {
+	s := newTestShell(t)
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{"exit; say a", "Exiting...\n"},
+		{"say b", ""},
+		{"alias x='say c'; x", ""},
+	}
+	for _, tt := range tests {
+		out := &bytes.Buffer{}
+		err := s.RunLineWith(tt.line, strings.NewReader(""), out, &bytes.Buffer{})
+		if !errors.Is(err, ErrShellExiting) || out.String() != tt.out {
+			t.Errorf("RunLineWith(%q) = %v, output %q, want %v, %q", tt.line, err, out, ErrShellExiting, tt.out)
+		}
+	}
+	if err := s.shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RunLineWith("say d", strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Errorf("RunLineWith() after shutdown = %v, want nil", err)
+	}
+}
+
+func TestOnExit(t *testing.T) {
+	errHook := errors.New("hook failed")
+	tests := []struct {
+		name   string
+		run    func(s *IShell) int
+		status int
+		hook   error
+	}{
+		{name: "exit", run: func(s *IShell) int { return s.RunArgs([]string{"exit"}) }},
+		{name: "cmd", run: func(s *IShell) int { return s.RunArgs([]string{"say", "a"}) }},
+		{name: "failed cmd", run: func(s *IShell) int { return s.RunArgs([]string{"fail"}) }, status: StatusError},
+		{name: "hook failed", run: func(s *IShell) int { return s.RunArgs([]string{"exit"}) }, status: StatusError, hook: errHook},
+		{
+			name: "script",
+			run: func(s *IShell) int {
+				s.runScriptMode("script", io.NopCloser(strings.NewReader("say a\nexit\nfail\n")))
+				return s.ExitStatus()
+			},
+		},
+		{
+			name: "script exits twice",
+			run: func(s *IShell) int {
+				s.runScriptMode("script", io.NopCloser(strings.NewReader("exit; exit\n")))
+				return s.ExitStatus()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			s.SetErrorRenderer(func(w io.Writer, err error) {})
+			calls := 0
+			s.OnExit(func() error {
+				calls++
+				return tt.hook
+			})
+			if status := tt.run(s); status != tt.status || calls != 1 {
+				t.Errorf("status %d, hook called %d times, want %d, 1", status, calls, tt.status)
+			}
+		})
+	}
+}
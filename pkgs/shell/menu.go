@@ -1,20 +1,32 @@
 package shell
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/reeflective/console"
+	"github.com/reeflective/readline"
+	"github.com/rsteube/carapace"
+	"github.com/spf13/cobra"
 )
 
-// setupPrompt is a function which sets up the prompts for the main menu.
+// setupPrompt is a function which sets up the prompts for a menu, showing the menu name.
 func SetupPrompt(m *console.Menu) {
 	p := m.Prompt()
 
 	p.Primary = func() string {
-		prompt := "\x1b[33mexample\x1b[0m [main] in \x1b[34m%s\x1b[0m\n> "
+		name := m.Name()
+		if name == MainMenu {
+			name = "main"
+		}
+		prompt := "\x1b[33mexample\x1b[0m [" + name + "] in \x1b[34m%s\x1b[0m\n> "
 		wd, _ := os.Getwd()
 
 		dir, err := filepath.Rel(os.Getenv("HOME"), wd)
@@ -32,3 +44,316 @@ func SetupPrompt(m *console.Menu) {
 
 	p.Transient = func() string { return "\x1b[1;30m" + ">> " + "\x1b[0m" }
 }
+
+const (
+	MainMenu string = "" // name of the default menu
+)
+
+var (
+	ErrMenuNotFound = errors.New("menu not found")
+	ErrMenuExists   = errors.New("menu already exists")
+	ErrInMainMenu   = errors.New("already in the main menu")
+)
+
+// IMenu is a named set of cmds with its own prompt, history and interrupt handlers,
+// eg: a "config" or "debug" mode of the shell. Cmds can be added, removed and replaced while the shell is running.
+type IMenu struct {
+	Name       string
+	HelpStr    string              // description of the menu in the output of the menu builtin
+	SetPrompt  func(*console.Menu) // SetupPrompt if nil
+	History    readline.History    // an in-memory history if nil
+	cmdList    []*ShellCmd
+	lock       *sync.RWMutex
+	interrupts map[error]func(*console.Console)
+	ready      bool // the console menu has been set up
+}
+
+func NewIMenu(name string) *IMenu {
+	return &IMenu{
+		Name:       name,
+		cmdList:    []*ShellCmd{},
+		lock:       &sync.RWMutex{},
+		interrupts: map[error]func(*console.Console){},
+	}
+}
+
+// AddInterrupt registers a handler for an error returned by readline while the menu is active,
+// it takes precedence over the handler registered by IShell.AddInterrupt for the same error.
+func (m *IMenu) AddInterrupt(err error, handler func(c *console.Console)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.interrupts[err] = handler
+}
+
+func (m *IMenu) getInterrupt(err error) func(c *console.Console) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return findInterrupt(m.interrupts, err)
+}
+
+// AddCmd adds a top level cmd, or a child cmd if command.Parent is set, see AddCmdE.
+func (m *IMenu) AddCmd(command *ShellCmd) {
+	m.AddCmdE(command)
+}
+
+// AddCmdE adds a cmd like AddCmd, ErrParentNotFound is returned if the parent cmd does not exist.
+func (m *IMenu) AddCmdE(command *ShellCmd) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.addCmd(command)
+}
+
+func (m *IMenu) addCmd(command *ShellCmd) error {
+	if command.Parent != "" {
+		return m.addChild(command.Parent, command)
+	}
+	command.setParent("")
+	m.cmdList = append(m.cmdList, command)
+	return nil
+}
+
+// AddChild adds a child cmd to the parent cmd addressed by path, eg: "net.route", see AddChildE.
+func (m *IMenu) AddChild(parent string, command *ShellCmd) {
+	m.AddChildE(parent, command)
+}
+
+// AddChildE adds a child cmd like AddChild, ErrParentNotFound is returned if the parent cmd does not exist.
+func (m *IMenu) AddChildE(parent string, command *ShellCmd) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.addChild(parent, command)
+}
+
+func (m *IMenu) addChild(parent string, command *ShellCmd) error {
+	p := m.findCmd(parent)
+	if p == nil {
+		return fmt.Errorf("%w: %s", ErrParentNotFound, parent)
+	}
+	p.AddChild(command)
+	return nil
+}
+
+// RemoveCmd removes the cmd addressed by path, eg: "net.route.add".
+func (m *IMenu) RemoveCmd(path string) error {
+	return m.ReplaceCmd(path, nil)
+}
+
+// ReplaceCmd replaces the cmd addressed by path with command, or removes it if command is nil.
+func (m *IMenu) ReplaceCmd(path string, command *ShellCmd) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.replaceCmd(path, command)
+}
+
+func (m *IMenu) replaceCmd(path string, command *ShellCmd) error {
+	list := &m.cmdList
+	parent, name := "", path
+	if i := strings.LastIndex(path, CmdPathSep); i >= 0 {
+		parent, name = path[:i], path[i+1:]
+		p := m.findCmd(parent)
+		if p == nil {
+			return fmt.Errorf("%w: %s", ErrParentNotFound, parent)
+		}
+		list = &p.Children
+	}
+	idx := slices.IndexFunc(*list, func(c *ShellCmd) bool { return c.Name == name })
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrCmdNotFound, path)
+	}
+	if command == nil {
+		*list = slices.Delete(*list, idx, idx+1)
+	} else {
+		command.setParent(parent)
+		(*list)[idx] = command
+	}
+	return nil
+}
+
+// FindCmd returns the cmd addressed by path, eg: "net.route.add".
+func (m *IMenu) FindCmd(path string) *ShellCmd {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.findCmd(path)
+}
+
+func (m *IMenu) findCmd(path string) *ShellCmd {
+	name, rest, _ := strings.Cut(path, CmdPathSep)
+	for _, c := range m.cmdList {
+		if c.Name != name {
+			continue
+		}
+		if rest == "" {
+			return c
+		}
+		return c.Find(rest)
+	}
+	return nil
+}
+
+// NewMenu declares a named menu, which can be entered with the menu builtin or IShell.SwitchMenu.
+func (s *IShell) NewMenu(name string) (*IMenu, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.menus[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrMenuExists, name)
+	}
+	m := NewIMenu(name)
+	s.menus[name] = m
+	return m, nil
+}
+
+// Menu returns a menu by name, MainMenu for the main menu, or nil if no menu is found.
+func (s *IShell) Menu(name string) *IMenu {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.menus[name]
+}
+
+// activeMenu returns the menu currently used by the console.
+func (s *IShell) activeMenu() *IMenu {
+	if m := s.Menu(s.Console.ActiveMenu().Name()); m != nil {
+		return m
+	}
+	return s.mainMenu
+}
+
+// setupMenu binds the prompt, history and cmds of a menu to its console menu once.
+func (s *IShell) setupMenu(m *IMenu) *console.Menu {
+	menu := s.Console.Menu(m.Name)
+	if menu == nil {
+		menu = s.Console.NewMenu(m.Name)
+	}
+	if m.ready {
+		return menu
+	}
+	m.ready = true
+
+	if m.SetPrompt == nil {
+		m.SetPrompt = SetupPrompt
+	}
+	m.SetPrompt(menu)
+
+	if m.History != nil {
+		menu.AddHistorySource("local_history", m.History)
+	}
+
+	// commands are regenerated for completion.
+	menu.SetCommands(func() *cobra.Command {
+		return s.newRootCmd(m)
+	})
+	return menu
+}
+
+// SwitchMenu switches the console to the "client" menu.
+//
+// Deprecated: use IShell.SwitchMenu, which enters menus created by IShell.NewMenu.
+func SwitchMenu(c *console.Console) {
+	fmt.Println("Switching to client menu")
+	c.SwitchMenu("client")
+}
+
+/*
+SwitchMenu enters the named menu, LeaveMenu returns to the previous one.
+Entering a menu which is already in the stack of entered menus returns to it.
+*/
+func (s *IShell) SwitchMenu(name string) error {
+	m := s.Menu(name)
+	if m == nil {
+		return fmt.Errorf("%w: %s", ErrMenuNotFound, name)
+	}
+	current := s.activeMenu()
+	if m == current {
+		return nil
+	}
+	s.setupMenu(m)
+
+	s.lock.Lock()
+	if idx := slices.Index(s.menuStack, name); idx >= 0 {
+		s.menuStack = s.menuStack[:idx]
+	} else {
+		s.menuStack = append(s.menuStack, current.Name)
+	}
+	s.lock.Unlock()
+
+	s.Console.SwitchMenu(name)
+	return nil
+}
+
+// LeaveMenu returns to the previous menu.
+func (s *IShell) LeaveMenu() error {
+	s.lock.Lock()
+	if len(s.menuStack) == 0 {
+		s.lock.Unlock()
+		return ErrInMainMenu
+	}
+	prev := s.menuStack[len(s.menuStack)-1]
+	s.menuStack = s.menuStack[:len(s.menuStack)-1]
+	s.lock.Unlock()
+
+	s.Console.SwitchMenu(prev)
+	return nil
+}
+
+// menuNames returns the names of the menus which can be entered, sorted.
+func (s *IShell) menuNames() (names []string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for name := range s.menus {
+		if name != MainMenu {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// inSubMenu reports whether the shell has entered a menu other than the main menu.
+func (s *IShell) inSubMenu() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.menuStack) > 0
+}
+
+// addMenuCommands adds the builtin cmds to enter and leave menus.
+func (s *IShell) addMenuCommands(rootCmd *cobra.Command, current *IMenu) {
+	names := s.menuNames()
+	if len(names) > 0 {
+		menuCmd := &cobra.Command{
+			Use:     "menu [name]",
+			Short:   "Enter a menu, or list menus.",
+			GroupID: BuiltinGroup.ID,
+			Args:    cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if len(args) > 0 {
+					return s.SwitchMenu(args[0])
+				}
+				for _, name := range names {
+					mark := " "
+					if name == current.Name {
+						mark = "*"
+					}
+					cmd.Printf("%s %-16s %s\n", mark, name, s.Menu(name).HelpStr)
+				}
+				return nil
+			},
+		}
+		described := []string{}
+		for _, name := range names {
+			described = append(described, name, s.Menu(name).HelpStr)
+		}
+		carapace.Gen(menuCmd).PositionalCompletion(carapace.ActionValuesDescribed(described...))
+		rootCmd.AddCommand(menuCmd)
+	}
+
+	if s.inSubMenu() {
+		rootCmd.AddCommand(&cobra.Command{
+			Use:     "back",
+			Short:   "Leave the current menu.",
+			GroupID: BuiltinGroup.ID,
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return s.LeaveMenu()
+			},
+		})
+	}
+}
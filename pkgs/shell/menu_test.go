@@ -0,0 +1,115 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/reeflective/console"
+	"github.com/reeflective/readline"
+	"github.com/spf13/cobra"
+)
+
+// newMenuShell returns a test shell with the menus "config" and "debug", each with a cmd named after it.
+func newMenuShell(t *testing.T) *IShell {
+	s := newTestShell(t)
+	for _, name := range []string{"config", "debug"} {
+		name := name
+		m, err := s.NewMenu(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.HelpStr = name + " mode"
+		c := NewShellCmd()
+		c.Name = name
+		c.Run = func(cmd *cobra.Command, args []string) {
+			fmt.Fprintln(cmd.OutOrStdout(), "in", name)
+		}
+		if err := m.AddCmdE(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestMenuSwitching(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		out     string
+		menu    string
+		err     error
+		unknown bool // cobra does not wrap an error for unknown cmds
+	}{
+		{name: "list", lines: []string{"menu"}, out: "  config           config mode\n  debug            debug mode\n"},
+		{name: "enter", lines: []string{"menu config", "config"}, out: "in config\n", menu: "config"},
+		{name: "list in menu", lines: []string{"menu config", "menu"}, out: "* config           config mode\n  debug            debug mode\n", menu: "config"},
+		{name: "back", lines: []string{"menu config", "back", "say a"}, out: "a\n"},
+		{name: "nested", lines: []string{"menu config", "menu debug", "back", "config"}, out: "in config\n", menu: "config"},
+		{name: "enter entered", lines: []string{"menu config", "menu debug", "menu config", "back"}},
+		{name: "cmds of other menus", lines: []string{"menu config", "debug"}, menu: "config", unknown: true},
+		{name: "cmds of main menu", lines: []string{"menu debug", "say a"}, menu: "debug", unknown: true},
+		{name: "back in main menu", lines: []string{"back"}, unknown: true},
+		{name: "not found", lines: []string{"menu nope"}, err: ErrMenuNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMenuShell(t)
+			out := &bytes.Buffer{}
+			var err error
+			for _, line := range tt.lines {
+				out.Reset()
+				err = s.RunLineWith(line, strings.NewReader(""), out, io.Discard)
+			}
+			if tt.unknown {
+				if err == nil || !strings.HasPrefix(err.Error(), "unknown command") {
+					t.Errorf("RunLineWith(%q) = %v, want unknown command", tt.lines[len(tt.lines)-1], err)
+				}
+			} else if !errors.Is(err, tt.err) || out.String() != tt.out {
+				t.Errorf("RunLineWith(%q) = %v, output %q, want %v, %q", tt.lines[len(tt.lines)-1], err, out, tt.err, tt.out)
+			}
+			if name := s.activeMenu().Name; name != tt.menu {
+				t.Errorf("active menu = %q, want %q", name, tt.menu)
+			}
+		})
+	}
+}
+
+func TestMenuInterrupts(t *testing.T) {
+	tests := []struct {
+		name string
+		menu string
+		err  error
+		want string
+	}{
+		{name: "menu handler", menu: "config", err: readline.ErrInterrupt, want: "config"},
+		{name: "shell handler in menu", menu: "config", err: io.EOF, want: "shell"},
+		{name: "shell handler", menu: MainMenu, err: readline.ErrInterrupt, want: "shell"},
+		{name: "menu handler of other menu", menu: "debug", err: readline.ErrInterrupt, want: "shell"},
+		{name: "no handler", menu: "debug", err: errors.New("other")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMenuShell(t)
+			called := ""
+			handler := func(name string) func(*console.Console) {
+				return func(*console.Console) { called = name }
+			}
+			s.AddInterrupt(readline.ErrInterrupt, handler("shell"))
+			s.AddInterrupt(io.EOF, handler("shell"))
+			s.Menu("config").AddInterrupt(readline.ErrInterrupt, handler("config"))
+			if tt.menu != MainMenu {
+				if err := s.SwitchMenu(tt.menu); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.handleInterrupt(tt.err)
+			if called != tt.want {
+				t.Errorf("handleInterrupt(%v) in menu %q called %q, want %q", tt.err, tt.menu, called, tt.want)
+			}
+		})
+	}
+}
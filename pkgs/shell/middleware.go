@@ -0,0 +1,68 @@
+package shell
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// RunFunc is the invocation of a cmd, Run of ShellCmd is converted to a RunFunc returning nil.
+type RunFunc func(cmd *cobra.Command, args []string) error
+
+// Middleware wraps the invocation of cmds, eg: for timing, logging, authorization or panic recovery.
+type Middleware func(next RunFunc) RunFunc
+
+// Use appends middlewares wrapping every cmd of every menu, the first one is the outermost.
+func (s *IShell) Use(middlewares ...Middleware) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// chain wraps the invocation of a cmd with the middlewares.
+func (s *IShell) chain(c *ShellCmd) RunFunc {
+	run := c.RunE
+	if c.RunData != nil {
+		run = func(cmd *cobra.Command, args []string) error {
+			data, err := c.RunData(cmd, args)
+			if err != nil {
+				return err
+			}
+			return RenderCmd(cmd, data, c.Columns)
+		}
+	}
+	if run == nil && c.Run != nil {
+		run = func(cmd *cobra.Command, args []string) error {
+			c.Run(cmd, args)
+			return nil
+		}
+	}
+	if run == nil {
+		return nil
+	}
+
+	s.lock.RLock()
+	middlewares := slices.Clone(s.middlewares)
+	s.lock.RUnlock()
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		run = middlewares[i](run)
+	}
+	return run
+}
+
+// Recover is a middleware converting a panic in a cmd to an error.
+func Recover() Middleware {
+	return func(next RunFunc) RunFunc {
+		return func(cmd *cobra.Command, args []string) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic in %q: %v", strings.TrimSpace(cmd.CommandPath()), r)
+				}
+			}()
+			return next(cmd, args)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// record returns a middleware which appends "name:before" and "name:after" around the cmd to calls.
+func record(calls *[]string, name string) Middleware {
+	return func(next RunFunc) RunFunc {
+		return func(cmd *cobra.Command, args []string) error {
+			*calls = append(*calls, name+":before")
+			err := next(cmd, args)
+			*calls = append(*calls, name+":after")
+			return err
+		}
+	}
+}
+
+var errDenied = errors.New("denied")
+
+// deny returns a middleware which fails without running the cmd.
+func deny(calls *[]string) Middleware {
+	return func(next RunFunc) RunFunc {
+		return func(cmd *cobra.Command, args []string) error {
+			*calls = append(*calls, "deny")
+			return errDenied
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		use   func(calls *[]string) []Middleware
+		line  string
+		out   string
+		calls string
+		err   error
+		panic bool // the error is a panic recovered by Recover
+	}{
+		{
+			name:  "none",
+			use:   func(calls *[]string) []Middleware { return nil },
+			line:  "say a",
+			out:   "a\n",
+			calls: "run",
+		},
+		{
+			name: "order",
+			use: func(calls *[]string) []Middleware {
+				return []Middleware{record(calls, "1"), record(calls, "2")}
+			},
+			line:  "say a",
+			out:   "a\n",
+			calls: "1:before 2:before run 2:after 1:after",
+		},
+		{
+			name: "error passed through",
+			use: func(calls *[]string) []Middleware {
+				return []Middleware{record(calls, "1")}
+			},
+			line:  "fail",
+			calls: "1:before 1:after",
+			err:   errFail,
+		},
+		{
+			name: "short circuit",
+			use: func(calls *[]string) []Middleware {
+				return []Middleware{record(calls, "1"), deny(calls), record(calls, "2")}
+			},
+			line:  "say a",
+			calls: "1:before deny 1:after",
+			err:   errDenied,
+		},
+		{
+			name: "each cmd of a line",
+			use: func(calls *[]string) []Middleware {
+				return []Middleware{record(calls, "1")}
+			},
+			line:  "say a; say b",
+			out:   "a\nb\n",
+			calls: "1:before run 1:after 1:before run 1:after",
+		},
+		{
+			name: "recover",
+			use: func(calls *[]string) []Middleware {
+				return []Middleware{record(calls, "1"), Recover()}
+			},
+			line:  "panic",
+			calls: "1:before 1:after",
+			panic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			calls := []string{}
+			// say records its invocation, panic panics.
+			say := s.FindCmd("say")
+			run := say.Run
+			say.Run = func(cmd *cobra.Command, args []string) {
+				calls = append(calls, "run")
+				run(cmd, args)
+			}
+			p := NewShellCmd()
+			p.Name = "panic"
+			p.Run = func(cmd *cobra.Command, args []string) {
+				panic("boom")
+			}
+			if err := s.AddCmdE(p); err != nil {
+				t.Fatal(err)
+			}
+			s.Use(tt.use(&calls)...)
+
+			out := &bytes.Buffer{}
+			err := s.RunLineWith(tt.line, strings.NewReader(""), out, io.Discard)
+			if tt.panic {
+				if err == nil || !strings.Contains(err.Error(), `panic in "panic": boom`) {
+					t.Errorf("RunLineWith(%q) = %v, want recovered panic", tt.line, err)
+				}
+			} else if !errors.Is(err, tt.err) {
+				t.Errorf("RunLineWith(%q) = %v, want %v", tt.line, err, tt.err)
+			}
+			if got := strings.Join(calls, " "); got != tt.calls || out.String() != tt.out {
+				t.Errorf("RunLineWith(%q) calls %q, output %q, want %q, %q", tt.line, got, out, tt.calls, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+type outputKey struct{}
+
+// output is the output and error writers of a cmd invocation.
+type output struct {
+	out io.Writer
+	err io.Writer
+}
+
+/*
+WithOutput returns a context carrying the output and error writers of a cmd invocation.
+The shell sets them for every cmd, so that output can be captured, piped, redirected or sent over the network.
+*/
+func WithOutput(ctx context.Context, out, err io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, output{out: out, err: err})
+}
+
+// Stdout returns the output writer carried by ctx, or os.Stdout.
+func Stdout(ctx context.Context) io.Writer {
+	if o, ok := ctx.Value(outputKey{}).(output); ok && o.out != nil {
+		return o.out
+	}
+	return os.Stdout
+}
+
+// Stderr returns the error writer carried by ctx, or os.Stderr.
+func Stderr(ctx context.Context) io.Writer {
+	if o, ok := ctx.Value(outputKey{}).(output); ok && o.err != nil {
+		return o.err
+	}
+	return os.Stderr
+}
+
+// IsTerminal reports whether w writes to a terminal, w is a terminal if it is a file or has the file descriptor of one.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+/*
+Fprintc writes a line to w, colored by color only if w is a terminal,
+eg: Fprintc(w, gprint.YellowStr, "Exiting...").
+*/
+func Fprintc(w io.Writer, color func(format string, v ...any) string, format string, v ...any) {
+	if IsTerminal(w) {
+		fmt.Fprintln(w, color(format, v...))
+		return
+	}
+	fmt.Fprintf(w, format+"\n", v...)
+}
+
+// detachWriter writes to w until it is detached, then writes fail with ErrInterrupted.
+type detachWriter struct {
+	w        io.Writer
+	detached atomic.Bool
+}
+
+func (d *detachWriter) Write(b []byte) (int, error) {
+	if d.detached.Load() {
+		return 0, ErrInterrupted
+	}
+	return d.w.Write(b)
+}
+
+func (d *detachWriter) detach() {
+	d.detached.Store(true)
+}
+
+// Fd returns the file descriptor of w, or an invalid one if w is not a file, see IsTerminal.
+func (d *detachWriter) Fd() uintptr {
+	if f, ok := d.w.(interface{ Fd() uintptr }); ok {
+		return f.Fd()
+	}
+	return ^uintptr(0)
+}
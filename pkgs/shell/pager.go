@@ -0,0 +1,442 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var ErrNotTerminal = errors.New("not a terminal")
+
+const (
+	AnnotationNoPager string = "gshell_no_pager" // cobra annotation of the cmds set NoPager
+	PagerStatusHint   string = "q quit, / search, n/N next/prev"
+	tabWidth          int    = 8
+)
+
+// SetPager sets whether the output of cmds longer than the terminal height is shown in the pager, enabled by default.
+func (s *IShell) SetPager(enabled bool) {
+	s.noPager = !enabled
+}
+
+/*
+Page shows text in a less-like pager on the terminal.
+
+	q, Ctrl-C                 quit
+	j, Enter, Down            one line down
+	k, y, Up                  one line up
+	Space, f, PgDn            one page down
+	b, PgUp                   one page up
+	d, u                      half a page down/up
+	g, Home / G, End          top/bottom
+	/pattern                  search forward
+	n, N                      next/previous match
+*/
+func Page(text string) error {
+	return page(os.Stdin, os.Stdout, text)
+}
+
+func page(in, out *os.File, text string) error {
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return ErrNotTerminal
+	}
+	p := &pager{in: in, out: out, buf: make([]byte, 256), lines: strings.Split(strings.TrimSuffix(text, "\n"), "\n")}
+	return p.run()
+}
+
+// pager is the state of a Page invocation.
+type pager struct {
+	in      *os.File
+	out     *os.File
+	lines   []string // lines of the text
+	rows    []string // screen rows of the wrapped lines
+	rowLine []int    // index in lines of every row
+	top     int      // first row on screen
+	width   int
+	height  int
+	pattern string   // last searched pattern
+	message string   // shown in the status line until the next key
+	keys    []string // keys read but not handled yet
+	buf     []byte
+}
+
+// readKey returns the next key pressed, an escape sequence is a single key.
+func (p *pager) readKey() (string, error) {
+	if len(p.keys) == 0 {
+		n, err := p.in.Read(p.buf)
+		if err != nil {
+			return "", err
+		}
+		p.keys = splitKeys(p.buf[:n])
+	}
+	key := p.keys[0]
+	p.keys = p.keys[1:]
+	return key, nil
+}
+
+// splitKeys splits the bytes read from the terminal into keys, eg: pasted text.
+func splitKeys(b []byte) (keys []string) {
+	for s := string(b); s != ""; {
+		key := escapeSeq(s)
+		if key == "" && len(s) > 2 && strings.HasPrefix(s, "\x1bO") {
+			key = s[:3]
+		}
+		if key == "" {
+			_, size := utf8.DecodeRuneInString(s)
+			key = s[:size]
+		}
+		keys = append(keys, key)
+		s = s[len(key):]
+	}
+	return
+}
+
+func (p *pager) run() error {
+	state, err := term.MakeRaw(int(p.in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(p.in.Fd()), state)
+	// alternate screen, hidden cursor.
+	fmt.Fprint(p.out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(p.out, "\x1b[?25h\x1b[?1049l")
+
+	for {
+		p.draw()
+		key, err := p.readKey()
+		if err != nil {
+			return err
+		}
+		p.message = ""
+		size := p.pageSize()
+		switch key {
+		case "q", "Q", "\x03":
+			return nil
+		case "j", "e", "\r", "\n", "\x0e", "\x1b[B", "\x1bOB":
+			p.scroll(1)
+		case "k", "y", "\x10", "\x1b[A", "\x1bOA":
+			p.scroll(-1)
+		case " ", "f", "\x06", "\x1b[6~":
+			p.scroll(size)
+		case "b", "\x02", "\x1b[5~":
+			p.scroll(-size)
+		case "d", "\x04":
+			p.scroll(size / 2)
+		case "u", "\x15":
+			p.scroll(-size / 2)
+		case "g", "<", "\x1b[H", "\x1b[1~", "\x1bOH":
+			p.top = 0
+		case "G", ">", "\x1b[F", "\x1b[4~", "\x1bOF":
+			p.scroll(len(p.rows))
+		case "/":
+			pattern, ok, err := p.prompt("/")
+			if err != nil {
+				return err
+			}
+			if ok {
+				if pattern != "" {
+					p.pattern = pattern
+				}
+				p.search(true, false)
+			}
+		case "n":
+			p.search(true, true)
+		case "N":
+			p.search(false, true)
+		}
+	}
+}
+
+func (p *pager) pageSize() int {
+	return max(p.height-1, 1)
+}
+
+func (p *pager) scroll(n int) {
+	p.top = min(max(p.top+n, 0), max(len(p.rows)-p.pageSize(), 0))
+}
+
+// resize wraps the lines again if the terminal size changes, keeping the first line on screen.
+func (p *pager) resize() {
+	width, height, err := term.GetSize(int(p.out.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	if width == p.width && height == p.height && p.rows != nil {
+		return
+	}
+	topLine := 0
+	if p.top < len(p.rowLine) {
+		topLine = p.rowLine[p.top]
+	}
+	p.width, p.height = width, height
+	p.rows, p.rowLine = p.rows[:0], p.rowLine[:0]
+	for i, line := range p.lines {
+		if i == topLine {
+			p.top = len(p.rows)
+		}
+		for _, row := range wrapLine(line, width) {
+			p.rows = append(p.rows, row)
+			p.rowLine = append(p.rowLine, i)
+		}
+	}
+	p.scroll(0)
+}
+
+func (p *pager) draw() {
+	p.resize()
+	b := &strings.Builder{}
+	b.WriteString("\x1b[H")
+	for i := p.top; i < p.top+p.pageSize(); i++ {
+		if i < len(p.rows) {
+			b.WriteString(p.highlight(p.rows[i]))
+		} else {
+			b.WriteString("~")
+		}
+		b.WriteString("\x1b[0m\x1b[K\r\n")
+	}
+	status := p.message
+	if status == "" {
+		last := min(p.top+p.pageSize(), len(p.rows))
+		status = fmt.Sprintf("lines %d-%d/%d", p.top+1, last, len(p.rows))
+		if last == len(p.rows) {
+			status += " (END)"
+		}
+		status += " (" + PagerStatusHint + ")"
+	}
+	b.WriteString("\x1b[7m" + runewidth.Truncate(status, p.width, "") + "\x1b[0m\x1b[K")
+	fmt.Fprint(p.out, b.String())
+}
+
+// highlight shows the matches of the searched pattern in reverse video, rows with escape sequences are left as is.
+func (p *pager) highlight(row string) string {
+	if p.pattern == "" || strings.Contains(row, "\x1b") {
+		return row
+	}
+	return strings.ReplaceAll(row, p.pattern, "\x1b[7m"+p.pattern+"\x1b[27m")
+}
+
+// prompt reads a line in the status line, ok is false if it is cancelled by Esc or Ctrl-C.
+func (p *pager) prompt(prefix string) (line string, ok bool, err error) {
+	for {
+		fmt.Fprintf(p.out, "\x1b[%d;1H\x1b[K%s%s\x1b[?25h", p.height, prefix, line)
+		key, err := p.readKey()
+		if err != nil {
+			return "", false, err
+		}
+		fmt.Fprint(p.out, "\x1b[?25l")
+		switch {
+		case key == "\r" || key == "\n":
+			return line, true, nil
+		case key == "\x1b" || key == "\x03":
+			return "", false, nil
+		case key == "\x7f" || key == "\x08":
+			if _, size := utf8.DecodeLastRuneInString(line); size > 0 {
+				line = line[:len(line)-size]
+			}
+		case utf8.ValidString(key) && key >= " " && key != "\x7f":
+			line += key
+		}
+	}
+}
+
+// search moves to the next line containing the pattern, or the previous one if forward is false.
+// The line on top is searched too unless next is true.
+func (p *pager) search(forward, next bool) {
+	if p.pattern == "" {
+		p.message = "No previous pattern"
+		return
+	}
+	current := 0
+	if p.top < len(p.rowLine) {
+		current = p.rowLine[p.top]
+	}
+	step := 1
+	if !forward {
+		step = -1
+	}
+	start := current
+	if next {
+		start += step
+	}
+	for i := start; i >= 0 && i < len(p.lines); i += step {
+		if strings.Contains(p.lines[i], p.pattern) {
+			for row, line := range p.rowLine {
+				if line == i {
+					p.top = row
+					break
+				}
+			}
+			p.scroll(0)
+			return
+		}
+	}
+	p.message = "Pattern not found: " + p.pattern
+}
+
+// wrapLine splits a line into rows of the width, tabs are expanded and escape sequences take no space.
+func wrapLine(line string, width int) (rows []string) {
+	width = max(width, 1)
+	b := &strings.Builder{}
+	col := 0
+	for i := 0; i < len(line); {
+		if seq := escapeSeq(line[i:]); seq != "" {
+			b.WriteString(seq)
+			i += len(seq)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		cell, w := string(r), runewidth.RuneWidth(r)
+		if r == '\t' {
+			// a tab ends at the next tab stop, or the end of the row.
+			w = tabWidth - col%tabWidth
+			if col < width {
+				w = min(w, width-col)
+			}
+			cell = strings.Repeat(" ", w)
+		}
+		if col+w > width && col > 0 {
+			rows = append(rows, b.String())
+			b.Reset()
+			col = 0
+		}
+		b.WriteString(cell)
+		col += w
+	}
+	return append(rows, b.String())
+}
+
+// escapeSeq returns the CSI escape sequence s starts with, eg: a color.
+func escapeSeq(s string) string {
+	if !strings.HasPrefix(s, "\x1b[") {
+		return ""
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return s[:i+1]
+		}
+	}
+	return s
+}
+
+/*
+pagerWriter writes the output of a cmd to the terminal until it has more lines than the terminal height.
+Then the output is buffered, and shown in the pager when the cmd returns.
+If the cmd is still writing after PagerTimeout, eg: slow or streaming output, the output is written to the terminal
+as it comes, so that the cmd does not look stuck, and it is still shown in the pager when the cmd returns.
+*/
+type pagerWriter struct {
+	in     *os.File
+	out    *os.File
+	height int
+	lines  int
+	paging bool // the output is longer than the terminal height
+	direct bool // the output is written to the terminal as it comes
+	closed bool // the cmd has returned, the output goes to the terminal directly
+	shown  int  // length of the output written to the terminal
+	timer  *time.Timer
+	buf    bytes.Buffer
+	lock   sync.Mutex
+	page   func(text string) error // shows the output in the pager
+}
+
+// PagerTimeout is how long the output of a cmd longer than the terminal height is held back before it is written as it comes.
+var PagerTimeout = time.Second
+
+func newPagerWriter(in, out *os.File, height int) *pagerWriter {
+	w := &pagerWriter{in: in, out: out, height: height}
+	w.page = func(text string) error {
+		return page(w.in, w.out, text)
+	}
+	return w
+}
+
+func (w *pagerWriter) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return w.out.Write(b)
+	}
+	w.buf.Write(b)
+	w.lines += bytes.Count(b, []byte("\n"))
+	if !w.paging && w.lines >= w.height {
+		// keep a line for the prompt.
+		w.paging = true
+		w.timer = time.AfterFunc(PagerTimeout, func() {
+			w.lock.Lock()
+			defer w.lock.Unlock()
+			w.flush()
+		})
+	}
+	if w.paging && !w.direct {
+		return len(b), nil
+	}
+	w.shown = w.buf.Len()
+	return w.out.Write(b)
+}
+
+// flush writes the output not shown yet to the terminal, the output written afterwards is written as it comes.
+func (w *pagerWriter) flush() error {
+	if w.direct || w.closed {
+		return nil
+	}
+	w.direct = true
+	_, err := w.out.Write(w.buf.Bytes()[w.shown:])
+	w.shown = w.buf.Len()
+	return err
+}
+
+// close shows the output in the pager if it is longer than the terminal height,
+// or writes the output not shown yet to the terminal if show is false, eg: for an interrupted cmd.
+// Output written afterwards goes to the terminal directly.
+func (w *pagerWriter) close(show bool) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if show && w.paging {
+		return w.page(w.buf.String())
+	}
+	_, err := w.out.Write(w.buf.Bytes()[w.shown:])
+	w.shown = w.buf.Len()
+	return err
+}
+
+// Fd returns the file descriptor of the terminal, see IsTerminal.
+func (w *pagerWriter) Fd() uintptr {
+	return w.out.Fd()
+}
+
+// pager returns the writer paging the output of a cmd, or nil if the cmd is not read from and written to a terminal.
+func (s *IShell) pager(root *cobra.Command, args []string, st execState) *pagerWriter {
+	in, ok := st.in.(*os.File)
+	if s.noPager || !ok || !term.IsTerminal(int(in.Fd())) {
+		return nil
+	}
+	out, ok := st.out.(*os.File)
+	if !ok || !IsTerminal(out) {
+		return nil
+	}
+	_, height, err := term.GetSize(int(out.Fd()))
+	if err != nil || height <= 0 {
+		return nil
+	}
+	if cmd, _, err := root.Find(args); err != nil || cmd.Annotations[AnnotationNoPager] == "true" {
+		return nil
+	}
+	return newPagerWriter(in, out, height)
+}
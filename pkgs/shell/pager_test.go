@@ -0,0 +1,150 @@
+package shell
+
+import (
+	"io"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		width int
+		want  []string
+	}{
+		{"", 4, []string{""}},
+		{"abc", 4, []string{"abc"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"a\tb", 4, []string{"a   ", "b"}},
+		{"abcd\tb", 4, []string{"abcd", "    ", "b"}},
+		{"a\tb", 10, []string{"a       b"}},
+		{"\x1b[31mabcd\x1b[0mef", 4, []string{"\x1b[31mabcd\x1b[0m", "ef"}},
+		{"你好吗", 4, []string{"你好", "吗"}},
+		{"abc", 0, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		if got := wrapLine(tt.line, tt.width); !slices.Equal(got, tt.want) {
+			t.Errorf("wrapLine(%q, %d) = %q, want %q", tt.line, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"q", []string{"q"}},
+		{"/line 1\r", []string{"/", "l", "i", "n", "e", " ", "1", "\r"}},
+		{"\x1b[A\x1b[6~j", []string{"\x1b[A", "\x1b[6~", "j"}},
+		{"\x1bOBk", []string{"\x1bOB", "k"}},
+		{"\x1b", []string{"\x1b"}},
+		{"é/", []string{"é", "/"}},
+	}
+	for _, tt := range tests {
+		if got := splitKeys([]byte(tt.input)); !slices.Equal(got, tt.want) {
+			t.Errorf("splitKeys(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// pagerOutput returns what is written to the terminal through a pagerWriter of height 3 closed by close, and what is paged.
+func pagerOutput(t *testing.T, writes []string, close func(w *pagerWriter)) (string, string) {
+	r, out, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w := newPagerWriter(nil, out, 3)
+	var paged string
+	w.page = func(text string) error {
+		paged = text
+		return nil
+	}
+	for _, s := range writes {
+		w.Write([]byte(s))
+	}
+	close(w)
+	out.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), paged
+}
+
+func TestPagerWriter(t *testing.T) {
+	writes := []string{"1\n", "2\n", "3\n", "4\n"}
+	// the timer writing the output of slow cmds as it comes.
+	flush := func(w *pagerWriter) {
+		w.lock.Lock()
+		w.flush()
+		w.lock.Unlock()
+	}
+	tests := []struct {
+		name   string
+		writes []string
+		close  func(w *pagerWriter)
+		out    string
+		paged  string
+	}{
+		{
+			name:   "short",
+			writes: writes[:2],
+			close:  func(w *pagerWriter) { w.close(true) },
+			out:    "1\n2\n",
+		},
+		{
+			name:   "long",
+			writes: writes,
+			close:  func(w *pagerWriter) { w.close(true) },
+			out:    "1\n2\n",
+			paged:  "1\n2\n3\n4\n",
+		},
+		{
+			name:   "interrupted",
+			writes: writes,
+			close:  func(w *pagerWriter) { w.close(false) },
+			out:    "1\n2\n3\n4\n",
+		},
+		{
+			name:   "slow",
+			writes: writes,
+			close: func(w *pagerWriter) {
+				flush(w)
+				w.Write([]byte("5\n"))
+				w.close(true)
+			},
+			out:   "1\n2\n3\n4\n5\n",
+			paged: "1\n2\n3\n4\n5\n",
+		},
+		{
+			name:   "slow interrupted",
+			writes: writes,
+			close: func(w *pagerWriter) {
+				flush(w)
+				w.Write([]byte("5\n"))
+				w.close(false)
+			},
+			out: "1\n2\n3\n4\n5\n",
+		},
+		{
+			name:   "written after close",
+			writes: writes[:1],
+			close: func(w *pagerWriter) {
+				w.close(true)
+				w.Write([]byte("2\n"))
+			},
+			out: "1\n2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, paged := pagerOutput(t, tt.writes, tt.close)
+			if out != tt.out || paged != tt.paged {
+				t.Errorf("output %q, paged %q, want %q, %q", out, paged, tt.out, tt.paged)
+			}
+		})
+	}
+}
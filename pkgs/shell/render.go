@@ -0,0 +1,295 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+	FormatText  Format = "text" // tab separated values without header
+)
+
+const (
+	OutputFlag  string = "output"
+	ColumnsFlag string = "columns"
+	SortFlag    string = "sort"
+	ValueColumn string = "value" // column of scalar items
+)
+
+var Formats = []string{string(FormatTable), string(FormatJSON), string(FormatYAML), string(FormatText)}
+
+var (
+	ErrFormatUnknown = errors.New("unknown output format")
+	ErrColumnUnknown = errors.New("unknown column")
+)
+
+// RenderOptions selects how structured output is rendered.
+type RenderOptions struct {
+	Format  Format
+	Columns []string // table columns in order, all columns if empty
+	SortBy  string   // column to sort table rows by, prefixed with "-" for descending order
+}
+
+/*
+Render writes data in a format.
+A slice is rendered as rows of a table, a struct or a map as a row, with a column for each field or key.
+Strings and []byte are written as they are in table and text formats.
+*/
+func Render(w io.Writer, data any, opts RenderOptions) error {
+	switch opts.Format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(data)
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(data)
+	case FormatTable, FormatText, "":
+		return renderTable(w, data, opts)
+	}
+	return fmt.Errorf("%w: %s", ErrFormatUnknown, opts.Format)
+}
+
+func renderTable(w io.Writer, data any, opts RenderOptions) error {
+	switch d := data.(type) {
+	case nil:
+		return nil
+	case string:
+		return writeText(w, d)
+	case []byte:
+		return writeText(w, string(d))
+	}
+
+	columns, rows := toTable(data)
+	if len(rows) == 0 {
+		columns = opts.Columns
+	}
+	if opts.SortBy != "" && len(rows) > 0 {
+		if err := sortRows(columns, rows, opts.SortBy); err != nil {
+			return err
+		}
+	}
+	if len(opts.Columns) > 0 && len(rows) > 0 {
+		selected := make([]string, 0, len(opts.Columns))
+		for _, name := range opts.Columns {
+			column, err := findColumn(columns, name)
+			if err != nil {
+				return err
+			}
+			selected = append(selected, column)
+		}
+		columns = selected
+	}
+
+	if opts.Format == FormatText {
+		for _, row := range rows {
+			cells := make([]string, len(columns))
+			for i, column := range columns {
+				cells[i] = row[column]
+			}
+			if _, err := fmt.Fprintln(w, strings.Join(cells, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = row[column]
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeText(w io.Writer, text string) error {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+	return v
+}
+
+// toTable converts data to columns and rows of cells keyed by column.
+func toTable(data any) (columns []string, rows []map[string]string) {
+	v := indirect(reflect.ValueOf(data))
+	items := []reflect.Value{v}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		items = items[:0]
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, v.Index(i))
+		}
+	}
+
+	seen := map[string]bool{}
+	addColumn := func(column string) {
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	for _, item := range items {
+		item = indirect(item)
+		row := map[string]string{}
+		switch {
+		case item.Kind() == reflect.Struct && !isScalar(item):
+			t := item.Type()
+			for i := 0; i < t.NumField(); i++ {
+				name, ok := fieldColumn(t.Field(i))
+				if !ok {
+					continue
+				}
+				addColumn(name)
+				row[name] = cell(item.Field(i))
+			}
+		case item.Kind() == reflect.Map && item.Type().Key().Kind() == reflect.String:
+			keys := make([]string, 0, item.Len())
+			for _, key := range item.MapKeys() {
+				keys = append(keys, key.String())
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				addColumn(key)
+				row[key] = cell(item.MapIndex(reflect.ValueOf(key).Convert(item.Type().Key())))
+			}
+		default:
+			addColumn(ValueColumn)
+			row[ValueColumn] = cell(item)
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+// fieldColumn returns the column of an exported struct field, named by its json tag if any.
+func fieldColumn(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// isScalar reports whether a value is rendered in a single cell, eg: time.Time.
+func isScalar(v reflect.Value) bool {
+	if !v.CanInterface() {
+		return false
+	}
+	switch v.Interface().(type) {
+	case fmt.Stringer, json.Marshaler:
+		return true
+	}
+	return false
+}
+
+// cell formats a value in a table cell, nested values are formatted as JSON.
+func cell(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if content, err := json.Marshal(v.Interface()); err == nil {
+			return string(content)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// findColumn returns the column matching name case-insensitively.
+func findColumn(columns []string, name string) (string, error) {
+	for _, column := range columns {
+		if strings.EqualFold(column, name) {
+			return column, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s, available columns: %s", ErrColumnUnknown, name, strings.Join(columns, ", "))
+}
+
+// sortRows sorts rows by a column, numerically if both cells are numbers.
+func sortRows(columns []string, rows []map[string]string, sortBy string) error {
+	desc := strings.HasPrefix(sortBy, "-")
+	column, err := findColumn(columns, strings.TrimPrefix(sortBy, "-"))
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i][column], rows[j][column]
+		if desc {
+			a, b = b, a
+		}
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			return fa < fb
+		}
+		return a < b
+	})
+	return nil
+}
+
+// outputOptions returns the flags selecting the rendering of the data returned by a cmd.
+func outputOptions() []*Flag {
+	return []*Flag{
+		{Name: OutputFlag, Short: "o", Type: OptionTypeString, Default: string(FormatTable), Usage: "output format.", Choices: Formats},
+		{Name: ColumnsFlag, Type: OptionTypeStringSlice, Usage: "columns of table output."},
+		{Name: SortFlag, Type: OptionTypeString, Usage: `column to sort table output by, prefixed with "-" for descending order.`},
+	}
+}
+
+// RenderCmd writes the data returned by a cmd to its output, as selected by the output flags.
+func RenderCmd(cmd *cobra.Command, data any, defaultColumns []string) error {
+	flags := cmd.Flags()
+	format, _ := flags.GetString(OutputFlag)
+	columns, _ := flags.GetStringSlice(ColumnsFlag)
+	sortBy, _ := flags.GetString(SortFlag)
+	if !flags.Changed(ColumnsFlag) {
+		columns = defaultColumns
+	}
+	return Render(cmd.OutOrStdout(), data, RenderOptions{Format: Format(format), Columns: columns, SortBy: sortBy})
+}
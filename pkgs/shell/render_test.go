@@ -0,0 +1,116 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type renderItem struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+func TestRender(t *testing.T) {
+	items := []renderItem{{"b", 10}, {"a", 9}, {"c", 100}}
+	tests := []struct {
+		name string
+		data any
+		opts RenderOptions
+		want string
+		err  error
+	}{
+		{
+			name: "table",
+			data: items,
+			want: "NAME  SIZE\nb     10\na     9\nc     100\n",
+		},
+		{
+			name: "sorted",
+			data: items,
+			opts: RenderOptions{SortBy: "name"},
+			want: "NAME  SIZE\na     9\nb     10\nc     100\n",
+		},
+		{
+			name: "sorted by number descending",
+			data: items,
+			opts: RenderOptions{SortBy: "-size"},
+			want: "NAME  SIZE\nc     100\nb     10\na     9\n",
+		},
+		{
+			name: "columns",
+			data: items,
+			opts: RenderOptions{Columns: []string{"SIZE"}},
+			want: "SIZE\n10\n9\n100\n",
+		},
+		{
+			name: "text",
+			data: items,
+			opts: RenderOptions{Format: FormatText, Columns: []string{"size", "name"}},
+			want: "10\tb\n9\ta\n100\tc\n",
+		},
+		{
+			name: "map",
+			data: map[string]any{"b": 2, "a": "x"},
+			want: "A  B\nx  2\n",
+		},
+		{
+			name: "scalars",
+			data: []string{"x", "y"},
+			want: "VALUE\nx\ny\n",
+		},
+		{
+			name: "string",
+			data: "plain",
+			want: "plain\n",
+		},
+		{
+			name: "empty",
+			data: []renderItem{},
+			opts: RenderOptions{Columns: []string{"name"}},
+			want: "NAME\n",
+		},
+		{
+			name: "json",
+			data: renderItem{"a&b", 1},
+			opts: RenderOptions{Format: FormatJSON},
+			want: "{\n  \"name\": \"a&b\",\n  \"size\": 1\n}\n",
+		},
+		{
+			name: "yaml",
+			data: []renderItem{{"a", 1}},
+			opts: RenderOptions{Format: FormatYAML},
+			want: "- name: a\n  size: 1\n",
+		},
+		{
+			name: "unknown column",
+			data: items,
+			opts: RenderOptions{Columns: []string{"owner"}},
+			err:  ErrColumnUnknown,
+		},
+		{
+			name: "unknown sort column",
+			data: items,
+			opts: RenderOptions{SortBy: "owner"},
+			err:  ErrColumnUnknown,
+		},
+		{
+			name: "unknown format",
+			data: items,
+			opts: RenderOptions{Format: "xml"},
+			err:  ErrFormatUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			err := Render(w, tt.data, tt.opts)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("Render() = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && w.String() != tt.want {
+				t.Errorf("Render() output %q, want %q", w, tt.want)
+			}
+		})
+	}
+}
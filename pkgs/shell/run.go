@@ -0,0 +1,568 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
+	"github.com/reeflective/console"
+	"github.com/spf13/cobra"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+var (
+	ErrUnsupportedSyntax = errors.New("unsupported syntax")
+	ErrInterrupted       = errors.New("interrupted")
+)
+
+const (
+	StatusOK          int = 0
+	StatusError       int = 1
+	StatusInterrupted int = 130
+)
+
+// ExitError carries an exit status for the error returned by a cmd.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func NewExitError(code int, err error) *ExitError {
+	return &ExitError{Code: code, Err: err}
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitStatus converts the error returned by a cmd to an exit status.
+func exitStatus(err error) int {
+	if err == nil {
+		return StatusOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	if errors.Is(err, ErrInterrupted) {
+		return StatusInterrupted
+	}
+	return StatusError
+}
+
+// RenderError is the default error renderer, errors are colored on a terminal.
+func RenderError(w io.Writer, err error) {
+	Fprintc(w, gprint.RedStr, "Error: %s", err.Error())
+}
+
+// SetErrorRenderer sets the function to print the errors returned by cmds to the error writer of the invocation.
+func (s *IShell) SetErrorRenderer(f func(w io.Writer, err error)) {
+	s.renderError = f
+}
+
+// ExitStatus returns the exit status of the last executed cmd, 0 for success.
+func (s *IShell) ExitStatus() int {
+	return int(s.status.Load())
+}
+
+func (s *IShell) setStatus(status int) {
+	s.status.Store(int32(status))
+}
+
+// execState is the input and outputs of a statement, and the aliases being expanded.
+type execState struct {
+	in        io.Reader
+	out       io.Writer
+	err       io.Writer
+	pipe      bool     // the statement is a part of a pipe
+	expanding []string // aliases being expanded
+}
+
+func newExecState() execState {
+	return execState{in: os.Stdin, out: os.Stdout, err: os.Stderr}
+}
+
+// AddInterrupt registers a handler for an error returned by readline in any menu,
+// eg: io.EOF for Ctrl-D, readline.ErrInterrupt for Ctrl-C.
+func (s *IShell) AddInterrupt(err error, handler func(c *console.Console)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.interrupts[err] = handler
+}
+
+func findInterrupt(interrupts map[error]func(*console.Console), err error) func(c *console.Console) {
+	for e, handler := range interrupts {
+		if e.Error() == err.Error() {
+			return handler
+		}
+	}
+	return nil
+}
+
+// handleInterrupt calls the handler of the active menu for err, or the handler of the shell.
+func (s *IShell) handleInterrupt(err error) {
+	handler := s.activeMenu().getInterrupt(err)
+	if handler == nil {
+		s.lock.RLock()
+		handler = findInterrupt(s.interrupts, err)
+		s.lock.RUnlock()
+	}
+	if handler != nil {
+		handler(s.Console)
+	}
+}
+
+// bindPrompt binds the prompt of a menu to readline.
+func (s *IShell) bindPrompt(menu *console.Menu) {
+	p, prompt := menu.Prompt(), s.Console.Shell().Prompt
+	prompt.Primary(func() string {
+		if p.Primary == nil {
+			return ""
+		}
+		return p.Primary()
+	})
+	prompt.Right(p.Right)
+	prompt.Secondary(p.Secondary)
+	prompt.Transient(p.Transient)
+	prompt.Tooltip(p.Tooltip)
+}
+
+func runHooks(hooks []func() error) error {
+	for _, hook := range hooks {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loop reads input lines and executes them until the shell exits.
+func (s *IShell) loop() error {
+	if s.printLogo != nil {
+		s.printLogo(s.Console)
+	}
+
+	for !s.exiting.Load() {
+		if s.Console.NewlineAfter {
+			fmt.Println()
+		}
+
+		menu := s.Console.ActiveMenu()
+		menu.Command = s.newRootCmd(s.activeMenu())
+		s.bindPrompt(menu)
+
+		if err := runHooks(s.Console.PreReadlineHooks); err != nil {
+			fmt.Printf("Pre-read error: %s\n", err.Error())
+			continue
+		}
+
+		// the line is recorded by readline, history references are resolved against the items before it.
+		hist, before := s.history(), 0
+		if hist != nil {
+			before = hist.Len()
+		}
+		line, err := s.Console.Shell().Readline()
+
+		if s.Console.NewlineBefore {
+			fmt.Println()
+		}
+
+		if err != nil {
+			s.handleInterrupt(err)
+			continue
+		}
+
+		expanded, err := s.expandLine(line, hist, before)
+		if err != nil {
+			s.fail(err, newExecState())
+			continue
+		}
+		if expanded != line {
+			// show the line executed, like bash.
+			fmt.Println(expanded)
+		}
+		s.RunLine(expanded)
+	}
+	return s.shutdown()
+}
+
+/*
+RunArgs executes a single cmd from args, eg: os.Args[1:], and returns the exit status.
+The interactive shell is started if args is empty.
+*/
+func (s *IShell) RunArgs(args []string) int {
+	if len(args) == 0 {
+		if err := s.Start(); err != nil && s.ExitStatus() == StatusOK {
+			s.setStatus(StatusError)
+		}
+		return s.ExitStatus()
+	}
+	s.run(args, newExecState())
+	if err := s.shutdown(); err != nil && s.ExitStatus() == StatusOK {
+		s.setStatus(StatusError)
+	}
+	return s.ExitStatus()
+}
+
+// Main runs the cmd from os.Args, or the interactive shell if no cmd is given, and exits the process with the exit status.
+func (s *IShell) Main() {
+	os.Exit(s.RunArgs(os.Args[1:]))
+}
+
+// RunLine parses and executes a line, cmds can be chained with ";", "&&", "||" and "|".
+func (s *IShell) RunLine(line string) error {
+	return s.runLine(line, newExecState())
+}
+
+/*
+RunLineWith executes a line like RunLine, with the input, output and error writers of the cmds,
+eg: to capture output, or to serve the shell over the network.
+*/
+func (s *IShell) RunLineWith(line string, in io.Reader, out, errOut io.Writer) error {
+	return s.runLine(line, execState{in: in, out: out, err: errOut})
+}
+
+func (s *IShell) runLine(line string, st execState) error {
+	f, err := syntax.NewParser(syntax.KeepComments(false)).Parse(strings.NewReader(line), "")
+	if err != nil {
+		s.fail(fmt.Errorf("parsing error: %w", err), st)
+		return err
+	}
+	for _, stmt := range f.Stmts {
+		err = s.runStmt(stmt, st)
+	}
+	return err
+}
+
+// fail records and renders an error which is not returned by a cmd.
+func (s *IShell) fail(err error, st execState) {
+	s.setStatus(exitStatus(err))
+	s.renderError(st.err, err)
+}
+
+func (s *IShell) runStmt(stmt *syntax.Stmt, st execState) error {
+	if stmt.Negated || stmt.Background || stmt.Coprocess {
+		err := fmt.Errorf("%w at %s", ErrUnsupportedSyntax, stmt.Pos())
+		s.fail(err, st)
+		return err
+	}
+	if len(stmt.Redirs) > 0 {
+		var (
+			closers []io.Closer
+			err     error
+		)
+		st, closers, err = s.redirect(stmt.Redirs, st)
+		for _, c := range closers {
+			defer c.Close()
+		}
+		if err != nil {
+			s.fail(err, st)
+			return err
+		}
+	}
+
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		if len(cmd.Args) == 0 {
+			err := s.assign(cmd.Assigns)
+			if err != nil {
+				s.fail(err, st)
+				return err
+			}
+			s.setStatus(StatusOK)
+			return nil
+		}
+		args, err := s.fields(cmd)
+		if err != nil {
+			s.fail(err, st)
+			return err
+		}
+		return s.run(args, st)
+	case *syntax.BinaryCmd:
+		switch cmd.Op {
+		case syntax.AndStmt:
+			if err := s.runStmt(cmd.X, st); err != nil {
+				return err
+			}
+			return s.runStmt(cmd.Y, st)
+		case syntax.OrStmt:
+			if err := s.runStmt(cmd.X, st); err == nil {
+				return nil
+			}
+			return s.runStmt(cmd.Y, st)
+		case syntax.Pipe:
+			return s.runPipe(cmd, st)
+		}
+	}
+	err := fmt.Errorf("%w at %s", ErrUnsupportedSyntax, stmt.Pos())
+	s.fail(err, st)
+	return err
+}
+
+/*
+runPipe runs both sides of a pipe concurrently, with the output of X as the input of Y.
+The exit status of the pipe is the exit status of Y.
+*/
+func (s *IShell) runPipe(cmd *syntax.BinaryCmd, st execState) error {
+	pr, pw := io.Pipe()
+	xst, yst := st, st
+	xst.out, yst.in = pw, pr
+	xst.pipe, yst.pipe = true, true
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Y reads EOF whether X succeeds or not.
+		s.runStmt(cmd.X, xst)
+		pw.Close()
+	}()
+
+	err := s.runStmt(cmd.Y, yst)
+	// X fails on writing if Y returns without reading all the output.
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+
+	s.setStatus(exitStatus(err))
+	return err
+}
+
+// redirect opens the files of redirections, and returns the state with redirected input and outputs.
+func (s *IShell) redirect(redirs []*syntax.Redirect, st execState) (execState, []io.Closer, error) {
+	var closers []io.Closer
+	for _, rd := range redirs {
+		name, err := expand.Literal(s.expandConfig(), rd.Word)
+		if err != nil {
+			return st, closers, err
+		}
+		fd := "1"
+		if rd.N != nil {
+			fd = rd.N.Value
+		}
+
+		if rd.Op == syntax.DplOut {
+			// eg: "2>&1", ">&2"
+			switch {
+			case fd == "2" && name == "1":
+				st.err = st.out
+			case fd == "1" && name == "2":
+				st.out = st.err
+			default:
+				return st, closers, fmt.Errorf("%w at %s", ErrUnsupportedSyntax, rd.Pos())
+			}
+			continue
+		}
+
+		var f *os.File
+		switch rd.Op {
+		case syntax.RdrIn:
+			if rd.N == nil || fd == "0" {
+				f, err = os.Open(name)
+				fd = "0"
+			}
+		case syntax.RdrOut, syntax.RdrAll:
+			f, err = os.Create(name)
+		case syntax.AppOut, syntax.AppAll:
+			f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		}
+		if err != nil {
+			return st, closers, err
+		}
+		if f == nil {
+			return st, closers, fmt.Errorf("%w at %s", ErrUnsupportedSyntax, rd.Pos())
+		}
+		closers = append(closers, f)
+
+		switch {
+		case rd.Op == syntax.RdrAll || rd.Op == syntax.AppAll:
+			st.out, st.err = f, f
+		case fd == "0":
+			st.in = f
+		case fd == "1":
+			st.out = f
+		case fd == "2":
+			st.err = f
+		default:
+			return st, closers, fmt.Errorf("%w at %s", ErrUnsupportedSyntax, rd.Pos())
+		}
+	}
+	return st, closers, nil
+}
+
+// fields converts the words of a cmd to args, with variables expanded.
+func (s *IShell) fields(call *syntax.CallExpr) ([]string, error) {
+	if len(call.Assigns) > 0 {
+		return nil, fmt.Errorf("%w at %s", ErrUnsupportedSyntax, call.Pos())
+	}
+	return expand.Fields(s.expandConfig(), call.Args...)
+}
+
+// run expands an alias in args, or executes args.
+func (s *IShell) run(args []string, st execState) error {
+	// cmds after exit are not executed, eg: "exit; say a".
+	if s.exiting.Load() {
+		return ErrShellExiting
+	}
+	if name, line, ok := s.expandAlias(args, st); ok {
+		return s.runAlias(name, line, st)
+	}
+	if st.pipe && s.isSystemCmd(args) {
+		return s.executeSystem(args, st)
+	}
+	return s.execute(args, st)
+}
+
+// execute runs a cmd in a new cmd tree, and records its exit status.
+func (s *IShell) execute(args []string, st execState) error {
+	if len(args) == 0 {
+		return nil
+	}
+	var err error
+	for _, hook := range s.Console.PreCmdRunLineHooks {
+		if args, err = hook(args); err != nil {
+			err = fmt.Errorf("line error: %w", err)
+			s.fail(err, st)
+			return err
+		}
+	}
+	if err = runHooks(s.Console.PreCmdRunHooks); err != nil {
+		err = fmt.Errorf("pre-run error: %w", err)
+		s.fail(err, st)
+		return err
+	}
+
+	// carapace sets up the cobra cmds of all the roots built so far when any root is executed,
+	// so the cmds of a pipe are built and set up one at a time, until they start running.
+	s.setupLock.Lock()
+	setupDone := sync.OnceFunc(s.setupLock.Unlock)
+	defer setupDone()
+	root := s.newRootCmd(s.activeMenu())
+	// cmds hidden by Console.HideCommands are not executed.
+	if target, _, err := root.Find(args); err == nil {
+		if err := s.Console.ActiveMenu().CheckIsAvailable(filterProbe(target)); err != nil {
+			return s.done(err, st)
+		}
+	}
+	root.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		setupDone()
+	}
+	pagerOut := s.pager(root, args, st)
+	if pagerOut != nil {
+		st.out = pagerOut
+	}
+	root.SetArgs(args)
+	root.SetIn(st.in)
+	err = s.executeContext(st, func(ctx context.Context, st execState) error {
+		root.SetOut(st.out)
+		root.SetErr(st.err)
+		return root.ExecuteContext(ctx)
+	})
+	if pagerOut != nil {
+		// the output of interrupted cmds is written to the terminal instead of the pager.
+		if pageErr := pagerOut.close(!errors.Is(err, ErrInterrupted)); err == nil {
+			err = pageErr
+		}
+	}
+	if err == nil {
+		err = runHooks(s.Console.PostCmdRunHooks)
+	}
+	return s.done(err, st)
+}
+
+// done records the exit status of a cmd, and renders its error.
+func (s *IShell) done(err error, st execState) error {
+	s.setStatus(exitStatus(err))
+	// errors of script lines have been rendered, system cmds print their own errors.
+	var (
+		scriptErr *ScriptError
+		execErr   *exec.ExitError
+	)
+	if err != nil && !errors.As(err, &scriptErr) && !errors.As(err, &execErr) {
+		s.renderError(st.err, err)
+	}
+	return err
+}
+
+// isSystemCmd reports whether args is not a cmd of the shell but an executable in PATH.
+func (s *IShell) isSystemCmd(args []string) bool {
+	// the root is built while another cmd of the pipe may be set up, see execute.
+	s.setupLock.Lock()
+	root := s.newRootCmd(s.activeMenu())
+	s.setupLock.Unlock()
+	if c, _, err := root.Find(args); err == nil && c != root {
+		return false
+	}
+	_, err := exec.LookPath(args[0])
+	return err == nil
+}
+
+// executeSystem runs a system cmd in a pipe, and records its exit status.
+func (s *IShell) executeSystem(args []string, st execState) error {
+	// the writers are passed to the system cmd as they are, eg: so that it can tell a terminal.
+	// The system cmd is killed on Ctrl-C.
+	err := s.executeContext(st, func(ctx context.Context, _ execState) error {
+		c := exec.CommandContext(ctx, args[0], args[1:]...)
+		c.Stdin, c.Stdout, c.Stderr = st.in, st.out, st.err
+		err := c.Run()
+		var execErr *exec.ExitError
+		// the exit code is -1 if the cmd is killed by a signal.
+		if errors.As(err, &execErr) && execErr.ExitCode() >= 0 {
+			return NewExitError(execErr.ExitCode(), err)
+		}
+		return err
+	})
+	return s.done(err, st)
+}
+
+/*
+executeContext executes a cmd with a context which is cancelled on Ctrl-C,
+and carries the output and error writers of st, which are passed to execute too.
+The shell waits for the cmd to return after cancellation, unless Ctrl-C is pressed again.
+Then the cmd is abandoned: it may still be running, but its output and error writers are detached,
+so that nothing is written over the next prompt.
+*/
+func (s *IShell) executeContext(st execState, execute func(ctx context.Context, st execState) error) error {
+	out, errOut := &detachWriter{w: st.out}, &detachWriter{w: st.err}
+	st.out, st.err = out, errOut
+	ctx, cancel := context.WithCancel(WithOutput(context.Background(), st.out, st.err))
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- execute(ctx, st)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-sigs:
+		cancel()
+	}
+
+	select {
+	case err := <-done:
+		if err == nil || errors.Is(err, context.Canceled) {
+			return ErrInterrupted
+		}
+		return fmt.Errorf("%w: %w", ErrInterrupted, err)
+	case <-sigs:
+		out.detach()
+		errOut.detach()
+		return ErrInterrupted
+	}
+}
@@ -0,0 +1,174 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+var errFail = errors.New("failed")
+
+// newTestShell returns a shell with the cmds:
+//
+//	say   writes its args to the output
+//	fail  writes "oops" to the error writer, and fails
+//	upper writes its input in upper case
+func newTestShell(t *testing.T) *IShell {
+	s := NewIShell()
+	say := NewShellCmd()
+	say.Name = "say"
+	say.Run = func(cmd *cobra.Command, args []string) {
+		fmt.Fprintln(cmd.OutOrStdout(), strings.Join(args, " "))
+	}
+	fail := NewShellCmd()
+	fail.Name = "fail"
+	fail.RunE = func(cmd *cobra.Command, args []string) error {
+		fmt.Fprintln(cmd.ErrOrStderr(), "oops")
+		return errFail
+	}
+	upper := NewShellCmd()
+	upper.Name = "upper"
+	upper.RunE = func(cmd *cobra.Command, args []string) error {
+		b, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), strings.ToUpper(string(b)))
+		return nil
+	}
+	for _, c := range []*ShellCmd{say, fail, upper} {
+		if err := s.AddCmdE(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.SetErrorRenderer(func(w io.Writer, err error) {
+		fmt.Fprintln(w, "error:", err)
+	})
+	return s
+}
+
+func TestRunLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		out     string
+		errOut  string
+		status  int
+		wantErr bool
+	}{
+		{name: "single", line: "say a b", out: "a b\n"},
+		{name: "list", line: "say a; say b", out: "a\nb\n"},
+		{name: "and ok", line: "say a && say b", out: "a\nb\n"},
+		{name: "and failed", line: "fail && say b", errOut: "oops\nerror: failed\n", status: StatusError, wantErr: true},
+		{name: "or ok", line: "say a || say b", out: "a\n"},
+		{name: "or failed", line: "fail || say b", out: "b\n", errOut: "oops\nerror: failed\n"},
+		{name: "pipe", line: "say a b | upper", out: "A B\n"},
+		{name: "pipes", line: "say a | upper | upper", out: "A\n"},
+		{name: "pipe status", line: "say a | fail", errOut: "oops\nerror: failed\n", status: StatusError, wantErr: true},
+		{name: "stderr to stdout", line: "fail 2>&1", out: "oops\nerror: failed\n", status: StatusError, wantErr: true},
+		{name: "stdout to stderr", line: "say a >&2", errOut: "a\n"},
+		{name: "variable", line: "x=b; say a $x", out: "a b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			err := s.RunLineWith(tt.line, strings.NewReader(""), out, errOut)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RunLineWith(%q) = %v, want error %v", tt.line, err, tt.wantErr)
+			}
+			if out.String() != tt.out {
+				t.Errorf("RunLineWith(%q) output %q, want %q", tt.line, out, tt.out)
+			}
+			if errOut.String() != tt.errOut {
+				t.Errorf("RunLineWith(%q) error output %q, want %q", tt.line, errOut, tt.errOut)
+			}
+			if s.ExitStatus() != tt.status {
+				t.Errorf("RunLineWith(%q) status %d, want %d", tt.line, s.ExitStatus(), tt.status)
+			}
+		})
+	}
+}
+
+func TestRunLineRedirect(t *testing.T) {
+	fPath := filepath.Join(t.TempDir(), "out.txt")
+	tests := []struct {
+		line string
+		file string
+	}{
+		{"say a > " + fPath, "a\n"},
+		{"say b > " + fPath, "b\n"},
+		{"say c >> " + fPath, "b\nc\n"},
+		{"fail 2> " + fPath, "oops\nerror: failed\n"},
+		{"fail > " + fPath + " 2>&1", "oops\nerror: failed\n"},
+		{"upper < " + fPath + " >> " + fPath, "oops\nerror: failed\nOOPS\nERROR: FAILED\n"},
+	}
+	s := newTestShell(t)
+	for _, tt := range tests {
+		out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+		s.RunLineWith(tt.line, strings.NewReader(""), out, errOut)
+		if out.Len() > 0 || errOut.Len() > 0 {
+			t.Errorf("RunLineWith(%q) wrote %q, %q", tt.line, out, errOut)
+		}
+		b, err := os.ReadFile(fPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.file {
+			t.Errorf("RunLineWith(%q) file %q, want %q", tt.line, b, tt.file)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	s := newTestShell(t)
+	debug := NewShellCmd()
+	debug.Name = "debug"
+	debug.Filters = []string{"release"}
+	trace := NewShellCmd()
+	trace.Name = "trace"
+	for _, c := range []*ShellCmd{debug, trace} {
+		c.Run = func(cmd *cobra.Command, args []string) {
+			cmd.Println(cmd.Name())
+		}
+	}
+	// the children of a filtered cmd are filtered too.
+	debug.AddChild(trace)
+	if err := s.AddCmdE(debug); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		hide   []string
+		show   []string
+		hidden bool
+	}{
+		{},
+		{hide: []string{"release"}, hidden: true},
+		{show: []string{"release"}},
+	}
+	for _, tt := range tests {
+		s.Console.HideCommands(tt.hide...)
+		if len(tt.show) > 0 {
+			// all the filters are removed without args.
+			s.Console.ShowCommands(tt.show...)
+		}
+		for _, args := range [][]string{{"debug"}, {"debug", "trace"}} {
+			line := strings.Join(args, " ")
+			out := &bytes.Buffer{}
+			err := s.RunLineWith(line, strings.NewReader(""), out, &bytes.Buffer{})
+			if (err != nil) != tt.hidden || (out.Len() == 0) != tt.hidden {
+				t.Errorf("hide %v, show %v: RunLineWith(%q) = %v, output %q, want hidden %v", tt.hide, tt.show, line, err, out, tt.hidden)
+			}
+			if cmd, _, _ := s.newRootCmd(s.activeMenu()).Find(args); cmd.Hidden != tt.hidden {
+				t.Errorf("hide %v, show %v: %q hidden %v, want %v", tt.hide, tt.show, line, cmd.Hidden, tt.hidden)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rsteube/carapace"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	ScriptComment string = "#"
+	StdinName     string = "<stdin>"
+)
+
+/*
+ScriptError is returned by RunScript for the line which stops a script.
+The error of the line has been rendered when the line was executed.
+*/
+type ScriptError struct {
+	Name string // script file name
+	Line int    // line number from 1
+	Err  error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Name, e.Line, e.Err.Error())
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// SetContinueOnError sets whether scripts continue after a line fails, scripts stop on the first error by default.
+func (s *IShell) SetContinueOnError(ok bool) {
+	s.continueOnError = ok
+}
+
+// SetScriptFile makes Start run the script file instead of reading commands interactively.
+func (s *IShell) SetScriptFile(fPath string) {
+	s.scriptFile = fPath
+}
+
+/*
+RunScript executes the lines read from r one by one, comments and blank lines are skipped.
+name is the script name in errors.
+*/
+func (s *IShell) RunScript(name string, r io.Reader) error {
+	return s.runScript(name, r, newExecState())
+}
+
+// runScript executes the lines of a script with the input and writers of st.
+func (s *IShell) runScript(name string, r io.Reader, st execState) error {
+	scanner := bufio.NewScanner(r)
+	var failed *ScriptError
+	for n := 1; scanner.Scan() && !s.exiting.Load(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ScriptComment) {
+			continue
+		}
+		if err := s.runLine(line, st); err != nil {
+			failed = &ScriptError{Name: name, Line: n, Err: err}
+			if !s.continueOnError {
+				return failed
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if failed != nil {
+		return failed
+	}
+	return nil
+}
+
+// RunFile executes the lines of a script file, see RunScript.
+func (s *IShell) RunFile(fPath string) error {
+	return s.runFile(fPath, newExecState())
+}
+
+func (s *IShell) runFile(fPath string, st execState) error {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.runScript(fPath, f, st)
+}
+
+// script returns the script Start should run instead of reading commands interactively, if any.
+func (s *IShell) script() (name string, r io.ReadCloser, err error) {
+	if s.scriptFile != "" {
+		r, err = os.Open(s.scriptFile)
+		return s.scriptFile, r, err
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return StdinName, io.NopCloser(os.Stdin), nil
+	}
+	return "", nil, nil
+}
+
+// runScriptMode executes a script, and runs the OnExit hooks.
+func (s *IShell) runScriptMode(name string, r io.ReadCloser) error {
+	defer r.Close()
+	err := s.RunScript(name, r)
+	if exitErr := s.shutdown(); err == nil {
+		err = exitErr
+	}
+	return err
+}
+
+// newSourceCmd returns the builtin cmd executing a script file.
+func (s *IShell) newSourceCmd() *cobra.Command {
+	sourceCmd := &cobra.Command{
+		Use:     "source <file>",
+		Short:   "Execute commands from a file.",
+		GroupID: BuiltinGroup.ID,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the lines are executed with the input and writers of source, eg: to redirect or pipe them.
+			st := execState{in: cmd.InOrStdin(), out: cmd.OutOrStdout(), err: cmd.ErrOrStderr()}
+			return s.runFile(args[0], st)
+		},
+	}
+	carapace.Gen(sourceCmd).PositionalCompletion(carapace.ActionFiles())
+	return sourceCmd
+}
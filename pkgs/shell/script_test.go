@@ -0,0 +1,54 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, []byte("# greeting\nsay a\n\nfail\nsay b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fPath := filepath.Join(dir, "out.txt")
+	tests := []struct {
+		name   string
+		line   string
+		out    string
+		errOut string
+		file   string
+		ok     bool // the status of a pipe is the status of its last cmd
+	}{
+		{name: "writers", line: "source " + script, out: "a\n", errOut: "oops\nerror: failed\n"},
+		{name: "pipe", line: "source " + script + " | upper", out: "A\n", errOut: "oops\nerror: failed\n", ok: true},
+		{name: "redirect", line: "source " + script + " > " + fPath, errOut: "oops\nerror: failed\n", file: "a\n"},
+		{name: "redirect all", line: "source " + script + " > " + fPath + " 2>&1", file: "a\noops\nerror: failed\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(fPath)
+			s := newTestShell(t)
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			if err := s.RunLineWith(tt.line, strings.NewReader(""), out, errOut); (err == nil) != tt.ok {
+				t.Errorf("RunLineWith(%q) = %v, want error %v", tt.line, err, !tt.ok)
+			}
+			if out.String() != tt.out || errOut.String() != tt.errOut {
+				t.Errorf("RunLineWith(%q) output %q, %q, want %q, %q", tt.line, out, errOut, tt.out, tt.errOut)
+			}
+			if tt.file == "" {
+				return
+			}
+			b, err := os.ReadFile(fPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.file {
+				t.Errorf("RunLineWith(%q) file %q, want %q", tt.line, b, tt.file)
+			}
+		})
+	}
+}
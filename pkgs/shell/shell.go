@@ -1,10 +1,15 @@
 package shell
 
 import (
-	"fmt"
+	"errors"
 	"io"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/gvcgo/goutils/pkgs/gtea/gprint"
@@ -16,26 +21,71 @@ import (
 )
 
 const (
-	GroupID string = "core"
+	GroupID        string = "core"
+	BuiltinGroupID string = "builtin"
 )
 
+var (
+	DefaultGroup = &CmdGroup{ID: GroupID, Title: "gshell commands: "}
+	BuiltinGroup = &CmdGroup{ID: BuiltinGroupID, Title: "builtin commands: "}
+)
+
+var (
+	ErrCmdNotFound    = errors.New("command not found")
+	ErrParentNotFound = errors.New("parent command not found")
+)
+
+/*
+IShell is an interactive shell, cmds are executed by IShell instead of Console.Start.
+The filters, prompts and hooks of Console are used, but Console.SetPrintLogo
+and the interrupt handlers of console menus are not, see IShell.SetPrintLogo and IShell.AddInterrupt.
+Cmds can be added, removed and replaced while the shell is running.
+*/
 type IShell struct {
-	Console   *console.Console
-	SetPrompt func(*console.Menu)
-	History   readline.History
-	cmdList   []*ShellCmd
-	flags     map[string][]IShellFlag
+	Console     *console.Console
+	SetPrompt   func(*console.Menu)
+	History     readline.History
+	mainMenu    *IMenu
+	menus       map[string]*IMenu
+	menuStack   []string // names of the menus entered before the active one
+	lock        *sync.RWMutex
+	setupLock   sync.Mutex // cmds are set up one at a time, see execute
+	flags       map[string][]IShellFlag
+	printLogo   func(*console.Console)
+	interrupts  map[error]func(*console.Console)
+	renderError func(w io.Writer, err error)
+	exitConfirm string
+	exitHooks   []func() error
+	middlewares []Middleware
+	exiting     atomic.Bool
+	status      atomic.Int32 // exit status of the last executed cmd
+
+	scriptFile      string // run by Start instead of reading commands interactively
+	continueOnError bool   // scripts continue after a line fails
+
+	aliases   map[string]string
+	aliasFile string
+	vars      map[string]string // session variables
+
+	noPager bool // long output is not shown in the pager
 }
 
 func NewIShell() (s *IShell) {
 	s = &IShell{
-		Console: console.New("gshell"),
-		flags:   map[string][]IShellFlag{},
-		cmdList: []*ShellCmd{},
+		Console:     console.New("gshell"),
+		flags:       map[string][]IShellFlag{},
+		mainMenu:    NewIMenu(MainMenu),
+		lock:        &sync.RWMutex{},
+		interrupts:  map[error]func(*console.Console){},
+		renderError: RenderError,
+		exitConfirm: DefaultExitConfirm,
+		aliases:     map[string]string{},
+		vars:        map[string]string{},
 	}
+	s.menus = map[string]*IMenu{MainMenu: s.mainMenu}
 	s.Console.NewlineBefore = false
 	s.Console.NewlineAfter = true
-	s.Console.SetPrintLogo(func(c *console.Console) {
+	s.SetPrintLogo(func(c *console.Console) {
 		gprint.Yellow("Welcome to gshell!")
 	})
 	return
@@ -45,153 +95,318 @@ func (s *IShell) SetupPrompt(setp func(*console.Menu)) {
 	s.SetPrompt = setp
 }
 
-func (s *IShell) setFlags(command *cobra.Command, opts ...*Flag) {
-	if command == nil || len(opts) == 0 {
+func (s *IShell) setFlags(flags *pflag.FlagSet, opts ...*Flag) {
+	if flags == nil || len(opts) == 0 {
 		return
 	}
-	command.ResetFlags()
 	for _, opt := range opts {
+		usage := opt.GetUsage()
+		if opt.IsRequired() {
+			usage += " (required)"
+		}
 		switch opt.GetType() {
 		case OptionTypeBool:
-			command.Flags().BoolP(opt.GetName(), opt.GetShort(), gconv.Bool(opt.GetDefault()), opt.GetUsage())
+			flags.BoolP(opt.GetName(), opt.GetShort(), gconv.Bool(opt.GetDefault()), usage)
 		case OptionTypeInt:
-			command.Flags().IntP(opt.GetName(), opt.GetShort(), gconv.Int(opt.GetDefault()), opt.GetUsage())
+			flags.IntP(opt.GetName(), opt.GetShort(), gconv.Int(opt.GetDefault()), usage)
 		case OptionTypeFloat:
-			command.Flags().Float64P(opt.GetName(), opt.GetShort(), gconv.Float64(opt.GetDefault()), opt.GetUsage())
+			flags.Float64P(opt.GetName(), opt.GetShort(), gconv.Float64(opt.GetDefault()), usage)
+		case OptionTypeUint:
+			flags.UintP(opt.GetName(), opt.GetShort(), gconv.Uint(opt.GetDefault()), usage)
+		case OptionTypeInt64:
+			flags.Int64P(opt.GetName(), opt.GetShort(), gconv.Int64(opt.GetDefault()), usage)
+		case OptionTypeDuration:
+			flags.DurationP(opt.GetName(), opt.GetShort(), gconv.Duration(opt.GetDefault()), usage)
+		case OptionTypeCount:
+			flags.CountP(opt.GetName(), opt.GetShort(), usage)
+		case OptionTypeStringSlice:
+			flags.StringSliceP(opt.GetName(), opt.GetShort(), SplitDefault(opt.GetDefault()), usage)
+		case OptionTypeIntSlice:
+			flags.IntSliceP(opt.GetName(), opt.GetShort(), gconv.Ints(SplitDefault(opt.GetDefault())), usage)
+		case OptionTypeStringMap:
+			flags.StringToStringP(opt.GetName(), opt.GetShort(), ParseStringMap(SplitDefault(opt.GetDefault())), usage)
 		default:
-			command.Flags().StringP(opt.GetName(), opt.GetShort(), opt.GetDefault(), opt.GetUsage())
+			flags.StringP(opt.GetName(), opt.GetShort(), opt.GetDefault(), usage)
 		}
 	}
 }
 
 func (s *IShell) Start() error {
 	// By default the shell as created a single menu and
-	// made it current, so you can access it and set it up.
-	menu := s.Console.ActiveMenu()
-
-	// Set some custom prompt handlers for this menu.
+	// made it current, the main menu is bound to it.
 	if s.SetPrompt == nil {
 		s.SetPrompt = SetupPrompt
 	}
-	s.SetPrompt(menu)
+	if s.mainMenu.SetPrompt == nil {
+		s.mainMenu.SetPrompt = s.SetPrompt
+	}
+	if s.mainMenu.History == nil {
+		s.mainMenu.History = s.History
+	}
+	s.setupMenu(s.mainMenu)
 
 	// history file
-	if s.History != nil {
-		menu.AddHistorySource("local_history", s.History)
+	if s.mainMenu.History != nil {
+		s.Console.Shell().History.Delete()
+		s.Console.Shell().History.Add("local_history", s.mainMenu.History)
 	}
 
 	// We bind a special handler for this menu, which will exit the
 	// application (with confirm), when the shell readline receives
 	// a Ctrl-D keystroke. You can map any error to any handler.
-	menu.AddInterrupt(io.EOF, ExitCtrlD)
+	if _, ok := s.interrupts[io.EOF]; !ok {
+		s.AddInterrupt(io.EOF, s.ExitCtrlD)
+	}
+
+	// run a script file or piped stdin non-interactively.
+	name, script, err := s.script()
+	if err != nil {
+		return err
+	}
+	if script != nil {
+		return s.runScriptMode(name, script)
+	}
+
+	s.bindCompleter()
+
+	err = s.loop()
+	return err
+}
 
-	menu.SetCommands(func() *cobra.Command {
-		rootCmd := &cobra.Command{
-			Short: "This is an interactive shell powered by gshell.",
+// newRootCmd generates the cobra cmd tree of a menu for the console.
+func (s *IShell) newRootCmd(m *IMenu) *cobra.Command {
+	rootCmd := &cobra.Command{
+		Short: "This is an interactive shell powered by gshell.",
+	}
+
+	m.lock.RLock()
+	s.addCommands(rootCmd, m.cmdList, nil, DefaultGroup)
+	m.lock.RUnlock()
+
+	// builtin commands
+	rootCmd.AddGroup(&cobra.Group{ID: BuiltinGroup.ID, Title: BuiltinGroup.Title})
+	rootCmd.AddCommand(&cobra.Command{
+		Use:     "exit",
+		Short:   "Exit gshell.",
+		GroupID: BuiltinGroup.ID,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			Fprintc(cmd.OutOrStdout(), gprint.YellowStr, "Exiting...")
+			s.Exit()
+		},
+	})
+
+	rootCmd.AddCommand(s.newSourceCmd())
+	rootCmd.AddCommand(s.newAliasCmds()...)
+	rootCmd.AddCommand(s.newVarCmds()...)
+	rootCmd.AddCommand(s.newHistoryCmd())
+	s.addMenuCommands(rootCmd, m)
+	hideFiltered(s.Console.ActiveMenu(), rootCmd)
+
+	rootCmd.SetHelpCommandGroupID(BuiltinGroup.ID)
+	rootCmd.InitDefaultHelpFlag()
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.DisableFlagsInUseLine = true
+	// errors are rendered by IShell.
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	return rootCmd
+}
+
+// hideFiltered hides the cmds unavailable in menu from help and completion, like Console.Start does.
+func hideFiltered(menu *console.Menu, cmd *cobra.Command) {
+	for _, c := range cmd.Commands() {
+		if !c.Hidden && len(menu.ActiveFiltersFor(filterProbe(c))) > 0 {
+			c.Hidden = true
+		}
+		hideFiltered(menu, c)
+	}
+}
+
+/*
+filterProbe returns a cmd named like cmd, with the filters of cmd and its ancestors and no parent.
+console.Menu.ActiveFiltersFor locks the console again for the parent of a nested cmd, so it is given probes.
+*/
+func filterProbe(cmd *cobra.Command) *cobra.Command {
+	var filters []string
+	for c := cmd; c != nil; c = c.Parent() {
+		if f := c.Annotations[console.CommandFilterKey]; f != "" {
+			filters = append(filters, f)
 		}
+	}
+	return &cobra.Command{
+		Use:         cmd.Use,
+		Annotations: map[string]string{console.CommandFilterKey: strings.Join(filters, ",")},
+	}
+}
 
-		rootCmd.AddGroup(&cobra.Group{ID: GroupID, Title: "gshell commands: "})
-
-		// additional commands
-		rootCmd.AddCommand(&cobra.Command{
-			Use:     "exit",
-			Short:   "Exit gshell.",
-			GroupID: GroupID,
-			Run: func(cmd *cobra.Command, args []string) {
-				gprint.Yellow("Exiting...")
-				os.Exit(0)
-			},
-		})
-
-		for _, c := range s.cmdList {
-			command := &cobra.Command{
-				Use:     c.Name,
-				Short:   c.HelpStr,
-				Long:    c.LongHelpStr,
-				GroupID: GroupID,
-				Run:     c.Run,
+// newCobraCmd converts a ShellCmd tree to a cobra cmd tree.
+// inherited are the persistent flags of ancestors.
+func (s *IShell) newCobraCmd(c *ShellCmd, inherited []*Flag) *cobra.Command {
+	inherited = append(append([]*Flag{}, inherited...), c.PersistentOptions...)
+	local := c.options(inherited)
+	opts := append(append([]*Flag{}, local...), inherited...)
+	command := &cobra.Command{
+		Use:     c.Name,
+		Aliases: append(append([]string{}, c.Aliases...), c.DeprecatedAliases...),
+		// deprecated cmds are hidden like cobra does, the notice is printed to the error writer below.
+		Hidden: c.Hidden || c.Deprecated != "",
+		Short:  c.HelpStr,
+		Long:   c.LongHelpStr,
+		RunE:   s.chain(c),
+		Annotations: map[string]string{
+			AnnotationNoPager:        strconv.FormatBool(c.NoPager),
+			console.CommandFilterKey: strings.Join(c.Filters, ","),
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if c.Deprecated != "" {
+				cmd.PrintErrf("Command %q is deprecated, %s\n", c.Name, c.Deprecated)
 			}
-			s.setFlags(command, c.Options...)
-			for _, child := range c.Children {
-				subCmd := &cobra.Command{
-					Use:   child.Name,
-					Short: child.HelpStr,
-					Long:  child.LongHelpStr,
-					Run:   child.Run,
-				}
-				s.setFlags(subCmd, child.Options...)
-				command.AddCommand(subCmd) // add subcommand
+			if c.IsDeprecatedAlias(cmd.CalledAs()) {
+				cmd.PrintErrf("Command %q is deprecated, use %q instead\n", cmd.CalledAs(), c.Name)
 			}
-			rootCmd.AddCommand(command)
+			return ValidateFlags(opts, c.MutuallyExclusive, c.RequiredTogether, NewCobraFlagSource(cmd.Flags()))
+		},
+	}
+	if c.Args != nil {
+		command.Use = strings.TrimSpace(c.Name + " " + ArgsUsage(c.Args))
+		command.Args = func(cmd *cobra.Command, args []string) error {
+			return ValidateArgs(c.Args, args)
 		}
-
-		for _, cmd := range rootCmd.Commands() {
-			c := carapace.Gen(cmd)
-
-			if cmd.Args != nil {
-				c.PositionalAnyCompletion(
-					carapace.ActionCallback(func(c carapace.Context) carapace.Action {
-						return carapace.ActionFiles()
-					}),
-				)
+		if help := ArgsHelp(c.Args); help != "" {
+			if command.Long == "" {
+				command.Long = command.Short
 			}
+			command.Long += "\n\n" + help
+		}
+	}
+	s.setFlags(command.Flags(), local...)
+	s.setFlags(command.PersistentFlags(), c.PersistentOptions...)
+	s.setCompletions(command, c, local)
+	s.addCommands(command, c.Children, inherited, nil)
+	return command
+}
 
-			flagMap := make(carapace.ActionMap)
-			cmd.Flags().VisitAll(func(f *pflag.Flag) {
-				if f.Name == "file" || strings.Contains(f.Usage, "file") {
-					flagMap[f.Name] = carapace.ActionFiles()
-				}
-			})
-
-			if cmd.Name() == "ssh" {
-				// Generate a list of random hosts to use as positional arguments
-				hosts := make([]string, 0)
-				for i := 0; i < 10; i++ {
-					hosts = append(hosts, fmt.Sprintf("host%d", i))
-				}
-				c.PositionalCompletion(carapace.ActionValues(hosts...))
+// addCommands adds children to the parent cobra cmd, and the groups of children sorted by Order.
+// Children without a group are put in defaultGroup if it is not nil.
+func (s *IShell) addCommands(parent *cobra.Command, children []*ShellCmd, inherited []*Flag, defaultGroup *CmdGroup) {
+	groups := []*CmdGroup{}
+	for _, child := range children {
+		command := s.newCobraCmd(child, inherited)
+		group := child.Group
+		if group == nil {
+			group = defaultGroup
+		}
+		if group != nil {
+			command.GroupID = group.ID
+			if !slices.ContainsFunc(groups, func(g *CmdGroup) bool { return g.ID == group.ID }) {
+				groups = append(groups, group)
 			}
+		}
+		parent.AddCommand(command) // add subcommand
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Order < groups[j].Order
+	})
+	for _, group := range groups {
+		parent.AddGroup(&cobra.Group{ID: group.ID, Title: group.Title})
+	}
+}
 
-			if cmd.Name() == "encrypt" {
-				cmd.Flags().VisitAll(func(f *pflag.Flag) {
-					if f.Name == "algorithm" {
-						flagMap[f.Name] = carapace.ActionValues("aes", "des", "blowfish")
-					}
-				})
-			}
+func (s *IShell) setCompletions(cmd *cobra.Command, sc *ShellCmd, local []*Flag) {
+	c := carapace.Gen(cmd)
 
-			c.FlagCompletion(flagMap)
-		}
+	if sc.Args == nil && sc.Completer != nil {
+		c.PositionalAnyCompletion(sc.Completer.Action())
+	}
 
-		rootCmd.SetHelpCommandGroupID(GroupID)
-		rootCmd.InitDefaultHelpFlag()
-		rootCmd.CompletionOptions.DisableDefaultCmd = true
-		rootCmd.DisableFlagsInUseLine = true
-		return rootCmd
-	})
+	positional := []carapace.Action{}
+	for _, arg := range sc.Args {
+		action := carapace.ActionValues()
+		if completer := getCompleter(arg.Completer, arg.Choices); completer != nil {
+			action = completer.Action()
+		}
+		if arg.Variadic {
+			c.PositionalAnyCompletion(action)
+		} else {
+			positional = append(positional, action)
+		}
+	}
+	if len(positional) > 0 {
+		c.PositionalCompletion(positional...)
+	}
 
-	err := s.Console.Start()
-	return err
+	flagMap := make(carapace.ActionMap)
+	for _, opt := range append(append([]*Flag{}, local...), sc.PersistentOptions...) {
+		if completer := getCompleter(opt.Completer, opt.Choices); completer != nil {
+			flagMap[opt.GetName()] = completer.Action()
+		}
+	}
+	c.FlagCompletion(flagMap)
 }
 
+// AddCmd adds a top level cmd to the main menu, or a child cmd if command.Parent is set, see AddCmdE.
 func (s *IShell) AddCmd(command *ShellCmd) {
-	s.cmdList = append(s.cmdList, command)
+	s.AddCmdE(command)
 }
 
+// AddCmdE adds a cmd like AddCmd, ErrParentNotFound is returned if the parent cmd does not exist.
+func (s *IShell) AddCmdE(command *ShellCmd) error {
+	return s.mainMenu.AddCmdE(command)
+}
+
+// AddChild adds a child cmd to the parent cmd of the main menu addressed by path, eg: "net.route", see AddChildE.
 func (s *IShell) AddChild(parent string, command *ShellCmd) {
-	for _, c := range s.cmdList {
-		if c.Name == parent {
-			c.AddChild(command)
-			return
-		}
+	s.AddChildE(parent, command)
+}
+
+// AddChildE adds a child cmd like AddChild, ErrParentNotFound is returned if the parent cmd does not exist.
+func (s *IShell) AddChildE(parent string, command *ShellCmd) error {
+	return s.mainMenu.AddChildE(parent, command)
+}
+
+// RemoveCmd removes the cmd of the main menu addressed by path, eg: "net.route.add".
+func (s *IShell) RemoveCmd(path string) error {
+	return s.mainMenu.RemoveCmd(path)
+}
+
+// ReplaceCmd replaces the cmd of the main menu addressed by path with command, or removes it if command is nil.
+func (s *IShell) ReplaceCmd(path string, command *ShellCmd) error {
+	return s.mainMenu.ReplaceCmd(path, command)
+}
+
+// FindCmd returns the cmd of the main menu addressed by path, eg: "net.route.add".
+func (s *IShell) FindCmd(path string) *ShellCmd {
+	return s.mainMenu.FindCmd(path)
+}
+
+/*
+bindCompleter regenerates the cmd tree before each completion,
+so that cmds added or removed while the shell is running are completed immediately.
+The tree is only written by the readline goroutine.
+*/
+func (s *IShell) bindCompleter() {
+	rl := s.Console.Shell()
+	complete := rl.Completer
+	rl.Completer = func(line []rune, cursor int) readline.Completions {
+		s.Console.ActiveMenu().Command = s.newRootCmd(s.activeMenu())
+		return complete(line, cursor)
 	}
 }
 
 func (s *IShell) SetPrintLogo(f func(_ *console.Console)) {
-	s.Console.SetPrintLogo(f)
+	s.printLogo = f
 }
 
+// The history file is used even if the alias file next to it cannot be loaded, the error is rendered, see SetHistoryFilePathE.
 func (s *IShell) SetHistoryFilePath(fPath string, maxLine int, enableLocal ...bool) {
+	if err := s.SetHistoryFilePathE(fPath, maxLine, enableLocal...); err != nil {
+		s.renderError(os.Stderr, err)
+	}
+}
+
+// SetHistoryFilePathE sets the history file like SetHistoryFilePath, the error of the alias file is returned.
+func (s *IShell) SetHistoryFilePathE(fPath string, maxLine int, enableLocal ...bool) error {
 	// All menus currently each have a distinct, in-memory history source.
 	// Replace the main (current) menu's history with one writing to our
 	// application history file. The default history is named after its menu.
@@ -199,4 +414,6 @@ func (s *IShell) SetHistoryFilePath(fPath string, maxLine int, enableLocal ...bo
 		fPath = ".gshell_local_history"
 	}
 	s.History, _ = EmbeddedHistory(fPath, maxLine, enableLocal...)
+	// aliases are saved next to the history file.
+	return s.SetAliasFilePath(aliasFilePath(fPath))
 }
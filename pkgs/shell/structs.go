@@ -0,0 +1,286 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrNotStructPointer = errors.New("not a pointer to struct")
+	ErrUnsupportedField = errors.New("unsupported field type")
+)
+
+/*
+Struct tags for flags and positional args.
+
+	type ShowOptions struct {
+		Enable  bool     `flag:"enable" short:"e" usage:"enable extra info"`
+		Version string   `flag:"version" short:"v" default:"v0.0.1" choices:"v0.0.1,v0.0.2"`
+		Level   int      `flag:"verbose" short:"V" type:"count"`
+		Host    string   `arg:"host" usage:"host to show"`
+		Files   []string `arg:"files" optional:"true"` // a slice arg is variadic
+	}
+*/
+const (
+	TagFlag     string = "flag"
+	TagArg      string = "arg"
+	TagShort    string = "short"
+	TagType     string = "type"
+	TagDefault  string = "default"
+	TagUsage    string = "usage"
+	TagRequired string = "required"
+	TagOptional string = "optional"
+	TagChoices  string = "choices"
+	TagMin      string = "min"
+	TagMax      string = "max"
+	TagPattern  string = "pattern"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func structElem(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return rv, fmt.Errorf("%w: %T", ErrNotStructPointer, v)
+	}
+	return rv.Elem(), nil
+}
+
+// fieldType returns the flag type for a struct field type.
+func fieldType(t reflect.Type) (FlagType, bool) {
+	if t == durationType {
+		return OptionTypeDuration, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return OptionTypeString, true
+	case reflect.Bool:
+		return OptionTypeBool, true
+	case reflect.Int:
+		return OptionTypeInt, true
+	case reflect.Int64:
+		return OptionTypeInt64, true
+	case reflect.Uint:
+		return OptionTypeUint, true
+	case reflect.Float64:
+		return OptionTypeFloat, true
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String:
+			return OptionTypeStringSlice, true
+		case reflect.Int:
+			return OptionTypeIntSlice, true
+		}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String {
+			return OptionTypeStringMap, true
+		}
+	}
+	return "", false
+}
+
+func splitTag(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+// ParseStruct returns the flags and positional args declared by the tagged fields of a struct pointer.
+func ParseStruct(v any) (opts []*Flag, args []*Arg, err error) {
+	rv, err := structElem(v)
+	if err != nil {
+		return
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		flagName, argName := field.Tag.Get(TagFlag), field.Tag.Get(TagArg)
+		if flagName == "" && argName == "" {
+			continue
+		}
+		fType, ok := fieldType(field.Type)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s %s", ErrUnsupportedField, field.Name, field.Type)
+		}
+		if t := field.Tag.Get(TagType); t != "" {
+			fType = FlagType(t)
+		}
+		if flagName != "" {
+			opts = append(opts, &Flag{
+				Name:     flagName,
+				Short:    field.Tag.Get(TagShort),
+				Type:     fType,
+				Default:  field.Tag.Get(TagDefault),
+				Usage:    field.Tag.Get(TagUsage),
+				Required: gconv.Bool(field.Tag.Get(TagRequired)),
+				Choices:  splitTag(field.Tag.Get(TagChoices)),
+				Min:      field.Tag.Get(TagMin),
+				Max:      field.Tag.Get(TagMax),
+				Pattern:  field.Tag.Get(TagPattern),
+			})
+		} else {
+			arg := &Arg{
+				Name:     argName,
+				Type:     fType,
+				Usage:    field.Tag.Get(TagUsage),
+				Optional: gconv.Bool(field.Tag.Get(TagOptional)),
+				Choices:  splitTag(field.Tag.Get(TagChoices)),
+			}
+			if field.Type.Kind() == reflect.Slice {
+				arg.Variadic = true
+				arg.Type = OptionTypeString
+				if field.Type.Elem().Kind() == reflect.Int {
+					arg.Type = OptionTypeInt
+				}
+			}
+			args = append(args, arg)
+		}
+	}
+	return
+}
+
+// setField sets a struct field from string values.
+func setField(fv reflect.Value, values []string) error {
+	if fv.Type() == durationType {
+		if len(values) == 0 {
+			return nil
+		}
+		d, err := time.ParseDuration(values[0])
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(fv.Type(), 0, len(values))
+		for _, value := range values {
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			if err := setField(elem, []string{value}); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		fv.Set(slice)
+		return nil
+	case reflect.Map:
+		fv.Set(reflect.ValueOf(ParseStringMap(values)))
+		return nil
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	value := values[0]
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedField, fv.Type())
+	}
+	return nil
+}
+
+/*
+BindStruct populates the tagged fields of a struct pointer from flags and positional args.
+Flags not set by user get their default values.
+*/
+func BindStruct(v any, src FlagSource, args []string) error {
+	opts, _, err := ParseStruct(v)
+	if err != nil {
+		return err
+	}
+	defaults := map[string]*Flag{}
+	for _, opt := range opts {
+		defaults[opt.GetName()] = opt
+	}
+
+	rv, _ := structElem(v)
+	rt := rv.Type()
+	argIdx := 0
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if name := field.Tag.Get(TagFlag); name != "" {
+			values := src.Values(name)
+			if opt := defaults[name]; !src.Changed(name) {
+				values = nil
+				if opt.GetType().IsMulti() {
+					values = SplitDefault(opt.GetDefault())
+				} else if opt.GetDefault() != "" {
+					values = []string{opt.GetDefault()}
+				}
+			}
+			if err := setField(rv.Field(i), values); err != nil {
+				return fmt.Errorf("flag --%s: %w", name, err)
+			}
+		} else if name := field.Tag.Get(TagArg); name != "" {
+			var values []string
+			if field.Type.Kind() == reflect.Slice && argIdx < len(args) {
+				values = args[argIdx:]
+				argIdx = len(args)
+			} else if argIdx < len(args) {
+				values = args[argIdx : argIdx+1]
+				argIdx++
+			}
+			if err := setField(rv.Field(i), values); err != nil {
+				return fmt.Errorf("arg %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+NewStructCmd creates a cmd whose flags and positional args are declared by the tagged fields of T.
+A new T is populated before each invocation of run, the cmd fails with the error if T cannot be populated.
+*/
+func NewStructCmd[T any](name string, run func(cmd *cobra.Command, opts *T) error) (sc *ShellCmd, err error) {
+	sc = NewShellCmd()
+	sc.Name = name
+	sc.Options, sc.Args, err = ParseStruct(new(T))
+	if err != nil {
+		return nil, err
+	}
+	sc.RunE = func(cmd *cobra.Command, args []string) error {
+		opts := new(T)
+		if err := BindStruct(opts, NewCobraFlagSource(cmd.Flags()), args); err != nil {
+			return err
+		}
+		return run(cmd, opts)
+	}
+	return
+}
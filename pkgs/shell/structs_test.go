@@ -0,0 +1,54 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestNewStructCmd(t *testing.T) {
+	type options struct {
+		// the flag is a string flag, the value is parsed when binding.
+		Level int    `flag:"level" type:"string" default:"1"`
+		Name  string `arg:"name"`
+	}
+	errRun := errors.New("run failed")
+	sc, err := NewStructCmd("greet", func(cmd *cobra.Command, opts *options) error {
+		if opts.Name == "fail" {
+			return errRun
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %d\n", opts.Name, opts.Level)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line   string
+		out    string
+		status int
+		err    error
+	}{
+		{"greet bob", "bob 1\n", StatusOK, nil},
+		{"greet bob --level 3", "bob 3\n", StatusOK, nil},
+		{"greet bob --level high", "", StatusError, strconv.ErrSyntax},
+		{"greet fail", "", StatusError, errRun},
+	}
+	s := NewIShell()
+	s.AddCmd(sc)
+	for _, tt := range tests {
+		out := &bytes.Buffer{}
+		err := s.RunLineWith(tt.line, strings.NewReader(""), out, &bytes.Buffer{})
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("RunLineWith(%q) = %v, want %v", tt.line, err, tt.err)
+		}
+		if out.String() != tt.out || s.ExitStatus() != tt.status {
+			t.Errorf("RunLineWith(%q) output %q, status %d, want %q, %d", tt.line, out, s.ExitStatus(), tt.out, tt.status)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/spf13/pflag"
+)
+
+var (
+	ErrFlagInvalid   = errors.New("invalid flag value")
+	ErrFlagRequired  = errors.New("required flag(s) not set")
+	ErrFlagExclusive = errors.New("flags cannot be used together")
+	ErrFlagTogether  = errors.New("flags must be used together")
+)
+
+func formatFlagNames(names []string) string {
+	fNames := make([]string, 0, len(names))
+	for _, name := range names {
+		fNames = append(fNames, "--"+name)
+	}
+	return strings.Join(fNames, ", ")
+}
+
+/*
+FlagSource provides the flags set by user,
+from cobra on client side and from queries on server side.
+*/
+type FlagSource interface {
+	Changed(name string) bool
+	Values(name string) []string
+}
+
+type cobraFlagSource struct {
+	flags *pflag.FlagSet
+}
+
+// NewCobraFlagSource returns a FlagSource reading from cobra flags.
+func NewCobraFlagSource(flags *pflag.FlagSet) FlagSource {
+	return &cobraFlagSource{flags: flags}
+}
+
+func (c *cobraFlagSource) Changed(name string) bool {
+	return c.flags.Changed(name)
+}
+
+func (c *cobraFlagSource) Values(name string) []string {
+	f := c.flags.Lookup(name)
+	if f == nil {
+		return nil
+	}
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.GetSlice()
+	}
+	if m, err := c.flags.GetStringToString(name); err == nil {
+		return FormatStringMap(m)
+	}
+	return []string{f.Value.String()}
+}
+
+// checkValue checks a single flag value against the choices, range and pattern of the flag.
+func checkValue(opt *Flag, value string) error {
+	if len(opt.Choices) > 0 && !slices.Contains(opt.Choices, value) {
+		return fmt.Errorf("%w: --%s=%s (allowed: %s)", ErrFlagInvalid, opt.GetName(), value, strings.Join(opt.Choices, ", "))
+	}
+
+	if opt.Min != "" || opt.Max != "" {
+		var v, min, max float64
+		if opt.GetType() == OptionTypeDuration {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%w: --%s=%s (%s)", ErrFlagInvalid, opt.GetName(), value, err)
+			}
+			v, min, max = float64(d), float64(gconv.Duration(opt.Min)), float64(gconv.Duration(opt.Max))
+		} else {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%w: --%s=%s (not a number)", ErrFlagInvalid, opt.GetName(), value)
+			}
+			v, min, max = f, gconv.Float64(opt.Min), gconv.Float64(opt.Max)
+		}
+		if opt.Min != "" && v < min {
+			return fmt.Errorf("%w: --%s=%s (must be >= %s)", ErrFlagInvalid, opt.GetName(), value, opt.Min)
+		}
+		if opt.Max != "" && v > max {
+			return fmt.Errorf("%w: --%s=%s (must be <= %s)", ErrFlagInvalid, opt.GetName(), value, opt.Max)
+		}
+	}
+
+	if opt.Pattern != "" {
+		ok, err := regexp.MatchString(opt.Pattern, value)
+		if err != nil {
+			return fmt.Errorf("%w: --%s (bad pattern: %s)", ErrFlagInvalid, opt.GetName(), err)
+		}
+		if !ok {
+			return fmt.Errorf("%w: --%s=%s (must match %s)", ErrFlagInvalid, opt.GetName(), value, opt.Pattern)
+		}
+	}
+	return nil
+}
+
+/*
+ValidateFlags checks flag values, required flags and flag groups.
+Only flags set by user are checked against their choices, range and pattern.
+*/
+func ValidateFlags(opts []*Flag, exclusive, together [][]string, src FlagSource) error {
+	changed := src.Changed
+	for _, opt := range opts {
+		if !changed(opt.GetName()) {
+			continue
+		}
+		for _, value := range src.Values(opt.GetName()) {
+			if err := checkValue(opt, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	missing := []string{}
+	for _, opt := range opts {
+		if opt.IsRequired() && !changed(opt.GetName()) {
+			missing = append(missing, opt.GetName())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrFlagRequired, formatFlagNames(missing))
+	}
+
+	for _, group := range exclusive {
+		set := []string{}
+		for _, name := range group {
+			if changed(name) {
+				set = append(set, name)
+			}
+		}
+		if len(set) > 1 {
+			return fmt.Errorf("%w: %s", ErrFlagExclusive, formatFlagNames(set))
+		}
+	}
+
+	for _, group := range together {
+		set, unset := []string{}, []string{}
+		for _, name := range group {
+			if changed(name) {
+				set = append(set, name)
+			} else {
+				unset = append(unset, name)
+			}
+		}
+		if len(set) > 0 && len(unset) > 0 {
+			return fmt.Errorf("%w: %s (missing %s)", ErrFlagTogether, formatFlagNames(group), formatFlagNames(unset))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package shell
+
+import (
+	"errors"
+	"testing"
+)
+
+// mapFlagSource is a FlagSource of the flags set by user.
+type mapFlagSource map[string][]string
+
+func (m mapFlagSource) Changed(name string) bool {
+	_, ok := m[name]
+	return ok
+}
+
+func (m mapFlagSource) Values(name string) []string {
+	return m[name]
+}
+
+func TestValidateFlagGroups(t *testing.T) {
+	opts := []*Flag{
+		{Name: "host", Type: OptionTypeString, Required: true},
+		{Name: "json", Type: OptionTypeBool},
+		{Name: "yaml", Type: OptionTypeBool},
+		{Name: "user", Type: OptionTypeString},
+		{Name: "password", Type: OptionTypeString},
+	}
+	exclusive := [][]string{{"json", "yaml"}}
+	together := [][]string{{"user", "password"}}
+	tests := []struct {
+		name string
+		src  mapFlagSource
+		want error
+	}{
+		{"required set", mapFlagSource{"host": {"a"}}, nil},
+		{"required missing", mapFlagSource{"json": {"true"}}, ErrFlagRequired},
+		{"one of exclusive", mapFlagSource{"host": {"a"}, "yaml": {"true"}}, nil},
+		{"both exclusive", mapFlagSource{"host": {"a"}, "json": {"true"}, "yaml": {"true"}}, ErrFlagExclusive},
+		{"all together", mapFlagSource{"host": {"a"}, "user": {"u"}, "password": {"p"}}, nil},
+		{"part of together", mapFlagSource{"host": {"a"}, "user": {"u"}}, ErrFlagTogether},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFlags(opts, exclusive, together, tt.src)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("ValidateFlags() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFlagValues(t *testing.T) {
+	opts := []*Flag{
+		{Name: "mode", Type: OptionTypeString, Choices: []string{"a", "b"}},
+		{Name: "port", Type: OptionTypeInt, Min: "1", Max: "65535"},
+		{Name: "timeout", Type: OptionTypeDuration, Max: "1m"},
+		{Name: "name", Type: OptionTypeString, Pattern: `^[a-z]+$`},
+		{Name: "tags", Type: OptionTypeStringSlice, Choices: []string{"x", "y"}},
+	}
+	tests := []struct {
+		name string
+		src  mapFlagSource
+		want error
+	}{
+		{"unset", mapFlagSource{}, nil},
+		{"choice", mapFlagSource{"mode": {"a"}}, nil},
+		{"not a choice", mapFlagSource{"mode": {"c"}}, ErrFlagInvalid},
+		{"in range", mapFlagSource{"port": {"8080"}}, nil},
+		{"below min", mapFlagSource{"port": {"0"}}, ErrFlagInvalid},
+		{"above max", mapFlagSource{"port": {"65536"}}, ErrFlagInvalid},
+		{"not a number", mapFlagSource{"port": {"http"}}, ErrFlagInvalid},
+		{"duration in range", mapFlagSource{"timeout": {"30s"}}, nil},
+		{"duration above max", mapFlagSource{"timeout": {"2m"}}, ErrFlagInvalid},
+		{"pattern", mapFlagSource{"name": {"bob"}}, nil},
+		{"not matching pattern", mapFlagSource{"name": {"Bob1"}}, ErrFlagInvalid},
+		{"slice choices", mapFlagSource{"tags": {"x", "y"}}, nil},
+		{"slice not a choice", mapFlagSource{"tags": {"x", "z"}}, ErrFlagInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFlags(opts, nil, nil, tt.src)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("ValidateFlags() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/rsteube/carapace"
+	"github.com/spf13/cobra"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const (
+	StatusVar string = "?" // special variable for the exit status of the last executed cmd
+)
+
+var (
+	ErrVarInvalid  = errors.New("invalid variable name")
+	ErrVarNotFound = errors.New("variable not found")
+)
+
+// SetVar sets a session variable, expanded as $name or ${name} in input lines.
+func (s *IShell) SetVar(name, value string) error {
+	if !syntax.ValidName(name) {
+		return fmt.Errorf("%w: %q", ErrVarInvalid, name)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.vars[name] = value
+	return nil
+}
+
+// UnsetVar deletes a session variable.
+func (s *IShell) UnsetVar(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.vars[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrVarNotFound, name)
+	}
+	delete(s.vars, name)
+	return nil
+}
+
+// Var returns a session variable.
+func (s *IShell) Var(name string) (value string, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	value, ok = s.vars[name]
+	return
+}
+
+// Vars returns a copy of the session variables.
+func (s *IShell) Vars() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	vars := make(map[string]string, len(s.vars))
+	for name, value := range s.vars {
+		vars[name] = value
+	}
+	return vars
+}
+
+// environ resolves variables in expansion: the last exit status, session variables, then environment variables.
+type environ struct {
+	s *IShell
+}
+
+func (e environ) Get(name string) expand.Variable {
+	if name == StatusVar {
+		return expand.Variable{Kind: expand.String, Str: strconv.Itoa(e.s.ExitStatus())}
+	}
+	if value, ok := e.s.Var(name); ok {
+		return expand.Variable{Kind: expand.String, Str: value}
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return expand.Variable{Exported: true, Kind: expand.String, Str: value}
+	}
+	return expand.Variable{}
+}
+
+func (e environ) Each(f func(name string, vr expand.Variable) bool) {
+	for _, pair := range os.Environ() {
+		name, value, _ := strings.Cut(pair, "=")
+		if !f(name, expand.Variable{Exported: true, Kind: expand.String, Str: value}) {
+			return
+		}
+	}
+	for name, value := range e.s.Vars() {
+		if !f(name, expand.Variable{Kind: expand.String, Str: value}) {
+			return
+		}
+	}
+}
+
+func (s *IShell) expandConfig() *expand.Config {
+	return &expand.Config{Env: environ{s}}
+}
+
+// assign sets session variables from the assignments of a line, eg: "NAME=value".
+func (s *IShell) assign(assigns []*syntax.Assign) error {
+	for _, as := range assigns {
+		if as.Append || as.Naked || as.Index != nil || as.Array != nil {
+			return fmt.Errorf("%w at %s", ErrUnsupportedSyntax, as.Pos())
+		}
+		value := ""
+		if as.Value != nil {
+			var err error
+			if value, err = expand.Literal(s.expandConfig(), as.Value); err != nil {
+				return err
+			}
+		}
+		if err := s.SetVar(as.Name.Value, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newVarCmds returns the builtin cmds to set, list and unset session variables.
+func (s *IShell) newVarCmds() []*cobra.Command {
+	setCmd := &cobra.Command{
+		Use:   "set [name=value...]",
+		Short: "Set or list session variables.",
+		Long: `Set or list session variables, expanded as $name or ${name} in input lines.
+Session variables take precedence over environment variables, $? is the exit status of the last command.`,
+		GroupID: BuiltinGroup.ID,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				vars := s.Vars()
+				for _, name := range sortedKeys(vars) {
+					cmd.Printf("%s=%s\n", name, shellquote.Join(vars[name]))
+				}
+				return nil
+			}
+			for _, arg := range args {
+				name, value, ok := strings.Cut(arg, "=")
+				if !ok {
+					return fmt.Errorf("%w: %q, expected name=value", ErrVarInvalid, arg)
+				}
+				if err := s.SetVar(name, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	unsetCmd := &cobra.Command{
+		Use:     "unset <name>...",
+		Short:   "Delete session variables.",
+		GroupID: BuiltinGroup.ID,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				if err := s.UnsetVar(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	carapace.Gen(unsetCmd).PositionalAnyCompletion(carapace.ActionCallback(func(c carapace.Context) carapace.Action {
+		vars := s.Vars()
+		described := []string{}
+		for _, name := range sortedKeys(vars) {
+			described = append(described, name, vars[name])
+		}
+		return carapace.ActionValuesDescribed(described...).Filter(c.Args...)
+	}))
+	return []*cobra.Command{setCmd, unsetCmd}
+}
@@ -0,0 +1,51 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	t.Setenv("GSHELL_TEST_ENV", "env")
+	tests := []struct {
+		name  string
+		lines []string
+		out   string
+		err   error
+	}{
+		{name: "expand", lines: []string{"set x=a", "say $x ${x}b"}, out: "a ab\n"},
+		{name: "assign", lines: []string{"x=a y=b", "say $x$y"}, out: "ab\n"},
+		{name: "assign expanded", lines: []string{"x=a", "y=${x}b", "say $y"}, out: "ab\n"},
+		{name: "quoted", lines: []string{"set x=a", `say '$x' "$x"`}, out: "$x a\n"},
+		{name: "value with spaces", lines: []string{"set 'x=a b'", "say [$x]"}, out: "[a b]\n"},
+		{name: "undefined", lines: []string{"say [$x]"}, out: "[]\n"},
+		{name: "environment", lines: []string{"say $GSHELL_TEST_ENV"}, out: "env\n"},
+		{name: "session over environment", lines: []string{"set GSHELL_TEST_ENV=session", "say $GSHELL_TEST_ENV"}, out: "session\n"},
+		{name: "status ok", lines: []string{"say a", "say $?"}, out: "0\n"},
+		{name: "status failed", lines: []string{"fail", "say $?"}, out: "1\n"},
+		{name: "list", lines: []string{"set b='x y' a=1", "set"}, out: "a=1\nb='x y'\n"},
+		{name: "unset", lines: []string{"set x=a y=b", "unset x", "set"}, out: "y=b\n"},
+		{name: "unset expanded", lines: []string{"set x=a", "unset x", "say [$x]"}, out: "[]\n"},
+		{name: "unset not found", lines: []string{"unset x"}, err: ErrVarNotFound},
+		{name: "set without value", lines: []string{"set x"}, err: ErrVarInvalid},
+		{name: "set invalid name", lines: []string{"set 1x=a"}, err: ErrVarInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShell(t)
+			out := &bytes.Buffer{}
+			var err error
+			for _, line := range tt.lines {
+				out.Reset()
+				err = s.RunLineWith(line, strings.NewReader(""), out, io.Discard)
+			}
+			line := tt.lines[len(tt.lines)-1]
+			if !errors.Is(err, tt.err) || out.String() != tt.out {
+				t.Errorf("RunLineWith(%q) = %v, output %q, want %v, %q", line, err, out, tt.err, tt.out)
+			}
+		})
+	}
+}